@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+// AlertConfig configures a webhook notification for a mount, it fires when
+// the listeners are below a threshold or the source has disappeared for a
+// number of consecutive polls
+type AlertConfig struct {
+	Mount   string            `yaml:"mount"`
+	Webhook string            `yaml:"webhook"`
+	Headers map[string]string `yaml:"headers"`
+	// Go template of the request body, defaults to a JSON payload
+	Body string `yaml:"body"`
+	// fire if the listeners are below this value, 1 fires on zero listeners
+	Below int `yaml:"below"`
+	// fire if a source that was seen before disappears
+	Missing bool `yaml:"missing"`
+	// number of consecutive polls the condition must hold, defaults to 1
+	For int `yaml:"for"`
+	// resend a firing alert after this time, 0 sends it only once
+	RepeatInterval time.Duration `yaml:"repeat_interval"`
+}
+
+// alertData is sent to the webhook and used as data of the body template
+type alertData struct {
+	Status     string    `json:"status"`
+	Reason     string    `json:"reason"`
+	Target     string    `json:"target"`
+	Mount      string    `json:"mount"`
+	ServerName string    `json:"server_name"`
+	Listeners  int       `json:"listeners"`
+	Threshold  int       `json:"threshold,omitempty"`
+	Since      time.Time `json:"since"`
+}
+
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+type alertRule struct {
+	AlertConfig
+	body *template.Template
+}
+
+// alertState is kept per rule and target
+type alertState struct {
+	seen       bool
+	serverName string
+	count      int
+	firing     bool
+	since      time.Time
+	lastSent   time.Time
+	last       alertData
+}
+
+type alertPublisher struct {
+	rules []*alertRule
+
+	mu     sync.Mutex
+	states map[*alertRule]map[string]*alertState
+}
+
+func newAlertPublisher(configs []AlertConfig) (*alertPublisher, error) {
+	a := &alertPublisher{states: map[*alertRule]map[string]*alertState{}}
+	for i, c := range configs {
+		if c.Mount == "" || c.Webhook == "" {
+			return nil, fmt.Errorf("alert %d needs a mount and a webhook", i+1)
+		}
+		if c.Below <= 0 && !c.Missing {
+			return nil, fmt.Errorf("alert %d needs below or missing", i+1)
+		}
+		if c.For < 1 {
+			c.For = 1
+		}
+		c.Mount = strings.TrimPrefix(c.Mount, "/")
+
+		rule := &alertRule{AlertConfig: c}
+		if c.Body != "" {
+			body, err := template.New("body").Funcs(templateFuncs).Parse(c.Body)
+			if err != nil {
+				return nil, fmt.Errorf("alert %d has an invalid body template: %w", i+1, err)
+			}
+			rule.body = body
+		}
+		a.rules = append(a.rules, rule)
+		a.states[rule] = map[string]*alertState{}
+	}
+	return a, nil
+}
+
+func (a *alertPublisher) publish(target string, streams []collector.Stream) {
+	a.evaluate(target, "", streams)
+}
+
+// publishMount only evaluates the rules of the polled mount
+func (a *alertPublisher) publishMount(target, mount string, streams []collector.Stream) {
+	a.evaluate(target, mount, streams)
+}
+
+// evaluate updates the rules of a mount, all rules without one
+func (a *alertPublisher) evaluate(target, mount string, streams []collector.Stream) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	for _, rule := range a.rules {
+		if mount != "" && rule.Mount != mount {
+			continue
+		}
+		state, ok := a.states[rule][target]
+		if !ok {
+			state = &alertState{}
+			a.states[rule][target] = state
+		}
+
+		data := alertData{Target: target, Mount: rule.Mount, Threshold: rule.Below}
+		found := false
+		for _, s := range streams {
+			if s.Mount == rule.Mount {
+				found = true
+				data.ServerName = s.ServerName
+				data.Listeners = s.Listeners
+				break
+			}
+		}
+
+		// a missing mount only counts once it has been seen on this target,
+		// otherwise every target without the mount would fire
+		bad := false
+		switch {
+		case found && rule.Below > 0 && data.Listeners < rule.Below:
+			bad = true
+			data.Reason = fmt.Sprintf("%d listeners below threshold of %d", data.Listeners, rule.Below)
+		case !found && rule.Missing && state.seen:
+			bad = true
+			data.Reason = "source disconnected"
+		}
+		if found {
+			state.seen = true
+			state.serverName = data.ServerName
+		} else {
+			data.ServerName = state.serverName
+		}
+
+		if !bad {
+			if state.firing {
+				data.Status = alertResolved
+				data.Reason = state.last.Reason
+				data.Since = state.since
+				go rule.send(data)
+			}
+			state.count = 0
+			state.firing = false
+			continue
+		}
+
+		state.count++
+		if state.count == 1 {
+			state.since = now
+		}
+		if state.count < rule.For {
+			continue
+		}
+
+		data.Status = alertFiring
+		data.Since = state.since
+		if !state.firing || (rule.RepeatInterval > 0 && now.Sub(state.lastSent) >= rule.RepeatInterval) {
+			state.firing = true
+			state.lastSent = now
+			go rule.send(data)
+		}
+		state.last = data
+	}
+}
+
+// forget drops the state of a removed target, a firing alert is not resolved
+// since the mount was not seen recovering
+func (a *alertPublisher) forget(target string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, states := range a.states {
+		delete(states, target)
+	}
+}
+
+func (r *alertRule) send(data alertData) {
+	if err := r.post(data); err != nil {
+		log.Printf("Error sending %s alert for %s: %v", data.Status, data.Mount, err)
+	}
+}
+
+func (r *alertRule) post(data alertData) error {
+	var body string
+	if r.body != nil {
+		b, err := executeTemplate(r.body, data)
+		if err != nil {
+			return err
+		}
+		body = b
+	} else {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		body = string(b)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.Webhook, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return nil
+}
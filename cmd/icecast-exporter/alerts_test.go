@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+const alertTarget = "http://localhost:8000/status-json.xsl"
+
+// alertWebhook collects the alerts posted to it
+func alertWebhook(t *testing.T) (string, chan alertData) {
+	t.Helper()
+	alerts := make(chan alertData, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data alertData
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			t.Errorf("decoding alert: %v", err)
+		}
+		alerts <- data
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, alerts
+}
+
+// expectAlerts checks the alerts sent since the last call by status
+func expectAlerts(t *testing.T, alerts chan alertData, want ...string) {
+	t.Helper()
+	for _, status := range want {
+		select {
+		case a := <-alerts:
+			if a.Status != status {
+				t.Fatalf("alert %s (%s), want %s", a.Status, a.Reason, status)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s alert sent", status)
+		}
+	}
+	select {
+	case a := <-alerts:
+		t.Fatalf("unexpected %s alert (%s)", a.Status, a.Reason)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func listeners(mount string, n int) []collector.Stream {
+	return []collector.Stream{{Target: alertTarget, ServerName: "Radio", Mount: mount, Listeners: n}}
+}
+
+func TestAlertBelowThreshold(t *testing.T) {
+	webhook, alerts := alertWebhook(t)
+	a, err := newAlertPublisher([]AlertConfig{{Mount: "live.mp3", Webhook: webhook, Below: 5, For: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		streams []collector.Stream
+		want    []string
+	}{
+		{listeners("live.mp3", 10), nil},
+		// has to hold for two polls
+		{listeners("live.mp3", 3), nil},
+		{listeners("live.mp3", 4), []string{alertFiring}},
+		// sent only once without repeat interval
+		{listeners("live.mp3", 2), nil},
+		{listeners("live.mp3", 5), []string{alertResolved}},
+		{listeners("live.mp3", 6), nil},
+		// the count starts again after a recovery
+		{listeners("live.mp3", 1), nil},
+		{listeners("live.mp3", 6), nil},
+	}
+	for i, step := range steps {
+		a.publish(alertTarget, step.streams)
+		t.Logf("poll %d", i+1)
+		expectAlerts(t, alerts, step.want...)
+	}
+}
+
+func TestAlertMissing(t *testing.T) {
+	webhook, alerts := alertWebhook(t)
+	a, err := newAlertPublisher([]AlertConfig{{Mount: "live.mp3", Webhook: webhook, Missing: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a mount never seen on the target does not fire
+	a.publish(alertTarget, nil)
+	expectAlerts(t, alerts)
+
+	a.publish(alertTarget, listeners("live.mp3", 1))
+	expectAlerts(t, alerts)
+	a.publish(alertTarget, listeners("other.mp3", 1))
+	expectAlerts(t, alerts, alertFiring)
+	a.publish(alertTarget, listeners("live.mp3", 0))
+	expectAlerts(t, alerts, alertResolved)
+
+	// a forgotten target starts over
+	a.forget(alertTarget)
+	a.publish(alertTarget, nil)
+	expectAlerts(t, alerts)
+}
+
+func TestAlertPublishMount(t *testing.T) {
+	webhook, alerts := alertWebhook(t)
+	a, err := newAlertPublisher([]AlertConfig{
+		{Mount: "live.mp3", Webhook: webhook, Below: 1},
+		{Mount: "news.mp3", Webhook: webhook, Below: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	streams := append(listeners("live.mp3", 1), listeners("news.mp3", 0)...)
+	a.publish(alertTarget, streams)
+	expectAlerts(t, alerts, alertFiring)
+
+	// only the rules of the polled mount are evaluated
+	streams = append(listeners("live.mp3", 0), listeners("news.mp3", 3)...)
+	a.publishMount(alertTarget, "live.mp3", streams)
+	expectAlerts(t, alerts, alertFiring)
+	a.publishMount(alertTarget, "news.mp3", streams)
+	expectAlerts(t, alerts, alertResolved)
+}
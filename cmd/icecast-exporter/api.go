@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+type apiStream struct {
+	// with the password masked, the API is unauthenticated
+	Target      string            `json:"target"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	ServerName  string            `json:"server_name"`
+	Description string            `json:"server_description,omitempty"`
+	Genre       string            `json:"genre,omitempty"`
+	Title       string            `json:"title,omitempty"`
+	Artist      string            `json:"artist,omitempty"`
+	Mount       string            `json:"mount"`
+	ListenURL   string            `json:"listen_url"`
+	Listeners   int               `json:"listeners"`
+	// time of the poll the stream was seen in
+	ScrapedAt time.Time `json:"scraped_at"`
+}
+
+type apiStreams struct {
+	Streams []apiStream `json:"streams"`
+}
+
+// streamsAPI serves the streams of the last poll of every target as JSON, so
+// clients like websites hit the exporter instead of the Icecast servers.
+// refresh is called first when polling on demand, nil otherwise
+func streamsAPI(targets *targetManager, refresh func(), corsOrigin string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if refresh != nil {
+			refresh()
+		}
+
+		resp := apiStreams{Streams: []apiStream{}}
+		for _, p := range targets.pollers() {
+			polled := p.lastPoll()
+			for _, s := range p.lastStreams() {
+				resp.Streams = append(resp.Streams, apiStream{
+					Target:      redactURL(s.Target),
+					Labels:      p.labels,
+					ServerName:  s.ServerName,
+					Description: s.Description,
+					Genre:       s.Genre,
+					Title:       s.Title,
+					Artist:      s.Artist,
+					Mount:       s.Mount,
+					ListenURL:   s.ListenURL,
+					Listeners:   s.Listeners,
+					ScrapedAt:   polled,
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if corsOrigin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", corsOrigin)
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Println("Error writing streams:", err)
+		}
+	})
+}
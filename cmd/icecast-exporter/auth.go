@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+var (
+	authSuccess = newServerCounters("icecast_listener_auth_success_total",
+		"Total number of listeners accepted by the listener authentication of a mount, from the admin stats", "stream_url")
+	authFailures = newServerCounters("icecast_listener_auth_failures_total",
+		"Total number of listeners rejected by the listener authentication of a mount, from the admin stats", "stream_url")
+)
+
+// AuthStatsConfig names the statistics of a mount in the admin stats counting
+// the listeners accepted and rejected by its listener authentication. Stock
+// Icecast does not count them, so the names depend on the server
+type AuthStatsConfig struct {
+	Success  string `yaml:"success"`
+	Failures string `yaml:"failures"`
+}
+
+// authCounters exports the listener authentication counters of the mounts of
+// a target
+type authCounters struct {
+	target      string
+	stats       AuthStatsConfig
+	legacyLabel bool
+
+	mu sync.Mutex
+	// mounts reporting the counters in the last admin stats
+	mounts map[string]bool
+}
+
+func newAuthCounters(target string, stats AuthStatsConfig, legacyLabel bool) *authCounters {
+	return &authCounters{
+		target:      target,
+		stats:       stats,
+		legacyLabel: legacyLabel,
+		mounts:      map[string]bool{},
+	}
+}
+
+func (a *authCounters) label(mount string) string {
+	if a.legacyLabel {
+		return collector.LegacyLabel(mount)
+	}
+	return mount
+}
+
+// update sets the counters of all mounts reporting them, nothing changes if
+// the admin stats could not be loaded
+func (a *authCounters) update(stats *icecast.AdminStats) {
+	if stats == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	current := map[string]bool{}
+	for _, s := range stats.Sources {
+		mount := strings.TrimPrefix(s.Mount, "/")
+		if a.set(authSuccess, s, a.stats.Success, mount) {
+			current[mount] = true
+		}
+		if a.set(authFailures, s, a.stats.Failures, mount) {
+			current[mount] = true
+		}
+	}
+	// mounts without authentication or disconnected sources
+	for mount := range a.mounts {
+		if !current[mount] {
+			authSuccess.delete(a.target, a.label(mount))
+			authFailures.delete(a.target, a.label(mount))
+		}
+	}
+	a.mounts = current
+}
+
+func (a *authCounters) set(counters *serverCounters, source icecast.AdminSource, stat, mount string) bool {
+	if stat == "" {
+		return false
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(source.Stats[stat]), 64)
+	if err != nil {
+		counters.delete(a.target, a.label(mount))
+		return false
+	}
+	counters.set(value, a.target, a.label(mount))
+	return true
+}
+
+// delete removes the metrics of the target
+func (a *authCounters) delete() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	authSuccess.deleteTarget(a.target)
+	authFailures.deleteTarget(a.target)
+	a.mounts = map[string]bool{}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+var availabilityDesc = prometheus.NewDesc("icecast_stream_availability_ratio",
+	"Ratio of the polls of a target in which the stream was available over a rolling window, failed polls count as unavailable",
+	[]string{"target", "stream_url", "window"}, nil)
+
+type availabilityBucket struct {
+	Start time.Time `json:"start"`
+	Up    int       `json:"up"`
+	Total int       `json:"total"`
+}
+
+func (b availabilityBucket) start() time.Time { return b.Start }
+
+// availabilityTracker counts for every mount seen once how often it was
+// present in the polls of its target, collected as
+// icecast_stream_availability_ratio
+type availabilityTracker struct {
+	*rollingState[availabilityBucket]
+	legacyLabel bool
+}
+
+func newAvailabilityTracker(windows []rollingWindow, stateFile string, legacyLabel bool) *availabilityTracker {
+	t := &availabilityTracker{
+		rollingState: newRollingState[availabilityBucket](windows, stateFile, "availability"),
+		legacyLabel:  legacyLabel,
+	}
+	reg.MustRegister(t)
+	return t
+}
+
+func (t *availabilityTracker) publish(target string, streams []collector.Stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	up := map[string]bool{}
+	for _, s := range streams {
+		up[s.Mount] = true
+		t.seriesOf(target, s.Mount)
+	}
+	t.observe(target, "", up)
+}
+
+// publishMount only counts the poll for the polled mount
+func (t *availabilityTracker) publishMount(target, mount string, streams []collector.Stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	up := map[string]bool{}
+	for _, s := range streams {
+		if s.Mount == mount {
+			up[s.Mount] = true
+			t.seriesOf(target, s.Mount)
+		}
+	}
+	t.observe(target, mount, up)
+}
+
+// pollFailed counts a failed poll as unavailable for all mounts of the target
+func (t *availabilityTracker) pollFailed(target string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.observe(target, "", nil)
+}
+
+// observe counts a poll for a mount of the target, for all mounts without one
+func (t *availabilityTracker) observe(target, mount string, up map[string]bool) {
+	now := time.Now()
+	for _, s := range t.series {
+		if s.Target != target || (mount != "" && s.Mount != mount) {
+			continue
+		}
+		for _, w := range t.windows {
+			buckets := bucketAt(s.Buckets[w.label], now, w, func(start time.Time) availabilityBucket {
+				return availabilityBucket{Start: start}
+			})
+			last := &buckets[len(buckets)-1]
+			last.Total++
+			if up[s.Mount] {
+				last.Up++
+			}
+			s.Buckets[w.label] = expireBuckets(buckets, now, w.duration)
+		}
+	}
+}
+
+func (t *availabilityTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- availabilityDesc
+}
+
+func (t *availabilityTracker) Collect(ch chan<- prometheus.Metric) {
+	// mounts not available during any window are forgotten
+	t.collect(func(s *rollingSeries[availabilityBucket], w rollingWindow, buckets []availabilityBucket) bool {
+		up, total := 0, 0
+		for _, b := range buckets {
+			up += b.Up
+			total += b.Total
+		}
+		if total > 0 {
+			mount := s.Mount
+			if t.legacyLabel {
+				mount = collector.LegacyLabel(mount)
+			}
+			ch <- prometheus.MustNewConstMetric(availabilityDesc, prometheus.GaugeValue, float64(up)/float64(total), s.Target, mount, w.label)
+		}
+		return up > 0
+	})
+}
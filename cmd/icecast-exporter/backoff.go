@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff computes exponentially growing delays with jitter for repeatedly
+// failing operations
+type backoff struct {
+	base     time.Duration
+	max      time.Duration
+	failures int
+	rand     *rand.Rand
+}
+
+func newBackoff(base time.Duration, max time.Duration) *backoff {
+	if max < base {
+		max = base
+	}
+	return &backoff{base: base, max: max, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// ceiling returns the delay before jitter for the current number of failures
+func (b *backoff) ceiling() time.Duration {
+	d := b.base
+	for i := 1; i < b.failures && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	return d
+}
+
+// atMax reports whether the delay has reached its upper bound
+func (b *backoff) atMax() bool {
+	return b.ceiling() >= b.max
+}
+
+// fail records a failure and returns the delay to wait before the next attempt,
+// chosen randomly between half and the full exponential delay
+func (b *backoff) fail() time.Duration {
+	b.failures++
+	d := b.ceiling()
+	half := int64(d / 2)
+	return time.Duration(half + b.rand.Int63n(half+1))
+}
+
+func (b *backoff) reset() {
+	b.failures = 0
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/prometheus/common/model"
+)
+
+// checkURL reports whether s is an absolute http or https URL
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid url %q, scheme must be http or https", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid url %q, missing host", s)
+	}
+	return nil
+}
+
+func checkLabels(labels map[string]string) error {
+	for name := range labels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if name == "server_name" || name == "stream_url" {
+			return fmt.Errorf("label %s is set by the exporter", name)
+		}
+	}
+	return nil
+}
+
+// validateConfig returns all problems of the config which are not already
+// reported while parsing it
+func validateConfig(config *Config, defaults TargetConfig, transports *transportPool) []error {
+	var errs []error
+	fail := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+
+	seen := map[string]bool{}
+	for i, t := range config.Targets {
+		if err := checkURL(t.URL); err != nil {
+			fail("target %d: %v", i+1, err)
+		}
+		if seen[t.URL] {
+			fail("target %d: duplicate url %s", i+1, t.URL)
+		}
+		seen[t.URL] = true
+		if err := checkLabels(t.Labels); err != nil {
+			fail("target %d: %v", i+1, err)
+		}
+		if t.Interval < 0 || t.Timeout < 0 {
+			fail("target %d: negative interval or timeout", i+1)
+		}
+		if _, err := transports.client(t.withDefaults(defaults)); err != nil {
+			fail("target %d: %v", i+1, err)
+		}
+		for _, m := range trimMountPatterns(t.Mounts) {
+			if err := m.validate(t.withDefaults(defaults).Interval); err != nil {
+				fail("target %d: %v", i+1, err)
+			}
+		}
+	}
+
+	clusters := map[string]bool{}
+	for i, c := range config.Clusters {
+		if clusters[c.Name] {
+			fail("cluster %d: duplicate name %s", i+1, c.Name)
+		}
+		clusters[c.Name] = true
+	}
+
+	for i, p := range config.Publishers {
+		if _, err := newWebhookPublisher(p); err != nil {
+			fail("publisher %d: %v", i+1, err)
+		}
+		if p.Interval < 0 {
+			fail("publisher %d: negative interval %s", i+1, p.Interval)
+		}
+	}
+
+	for i, c := range config.Clocks {
+		if _, err := newVClockPublisher(c, vclockOptions{}); err != nil {
+			fail("VClock %d: %v", i+1, err)
+		}
+		if c.MinInterval < 0 {
+			fail("VClock %d: negative min_interval %s", i+1, c.MinInterval)
+		}
+	}
+
+	if _, err := newProfileChecker(config.Profiles, false); err != nil {
+		fail("profiles: %v", err)
+	}
+
+	if _, err := newAlertPublisher(config.Alerts); err != nil {
+		fail("alerts: %v", err)
+	}
+	for i, a := range config.Alerts {
+		if a.Webhook != "" {
+			if err := checkURL(a.Webhook); err != nil {
+				fail("alert %d: %v", i+1, err)
+			}
+		}
+		if a.RepeatInterval < 0 {
+			fail("alert %d: negative repeat_interval %s", i+1, a.RepeatInterval)
+		}
+	}
+
+	for i, n := range config.Notifiers {
+		if err := n.validate(); err != nil {
+			fail("notifier %d: %v", i+1, err)
+		} else if err := checkURL(n.URL); err != nil {
+			fail("notifier %d: %v", i+1, err)
+		}
+		if n.MinInterval < 0 {
+			fail("notifier %d: negative min_interval %s", i+1, n.MinInterval)
+		}
+	}
+	if len(config.Notifiers) > 0 && len(config.ExpectedMounts) == 0 {
+		fail("notifiers need expected_mounts")
+	}
+	return errs
+}
+
+// probeTargets polls every target once and prints whether it is reachable
+// and how many sources it reports, it returns the number of failed targets
+func probeTargets(targets []TargetConfig, defaults TargetConfig, transports *transportPool) int {
+	failed := 0
+	for _, t := range targets {
+		t = t.withDefaults(defaults)
+		client, err := transports.client(t)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", t.URL, err)
+			failed++
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+		status, err := client.Status(ctx, t.URL)
+		cancel()
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", t.URL, err)
+			failed++
+			continue
+		}
+		fmt.Printf("OK   %s: %d sources\n", t.URL, len(status.Icestats.Source))
+	}
+	return failed
+}
+
+// checkConfig validates the config and the targets file and optionally probes
+// all targets, it returns the exit code of the process
+func checkConfig(config *Config, defaults TargetConfig, transports *transportPool, targetsFile string, probe bool) int {
+	targets := config.Targets
+	var errs []error
+	if targetsFile != "" {
+		loaded, err := loadTargetsFile(targetsFile)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for i, t := range loaded {
+			if err := checkURL(t.URL); err != nil {
+				errs = append(errs, fmt.Errorf("%s target %d: %v", targetsFile, i+1, err))
+			}
+		}
+		targets = append(targets, loaded...)
+	}
+	errs = append(errs, validateConfig(config, defaults, transports)...)
+
+	for _, err := range errs {
+		fmt.Println("ERROR", err)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	fmt.Printf("config OK: %d targets, %d publishers, %d VClocks, %d alerts, %d notifiers\n",
+		len(targets), len(config.Publishers), len(config.Clocks), len(config.Alerts), len(config.Notifiers))
+
+	if probe && probeTargets(targets, defaults, transports) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+var (
+	listenerConnects = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "icecast_listener_connects_total",
+		Help: "Total number of listeners connected to a mount, from the admin client list",
+	}, []string{"target", "stream_url"})
+	listenerDisconnects = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "icecast_listener_disconnects_total",
+		Help: "Total number of listeners disconnected from a mount, from the admin client list",
+	}, []string{"target", "stream_url"})
+)
+
+// listenerChurn counts connects and disconnects of listeners of a target from
+// the differences between successive admin client lists
+type listenerChurn struct {
+	target string
+	// scheme and host of the target
+	server      string
+	admin       *icecast.Client
+	timeout     time.Duration
+	legacyLabel bool
+
+	mu sync.Mutex
+	// ids of the clients of the last poll per mount
+	clients map[string]map[string]bool
+	lastErr string
+}
+
+func newListenerChurn(target string, admin *icecast.Client, timeout time.Duration, legacyLabel bool) (*listenerChurn, error) {
+	server, err := icecast.ServerURL(target)
+	if err != nil {
+		return nil, err
+	}
+	return &listenerChurn{
+		target:      target,
+		server:      server,
+		admin:       admin,
+		timeout:     timeout,
+		legacyLabel: legacyLabel,
+		clients:     map[string]map[string]bool{},
+	}, nil
+}
+
+func (c *listenerChurn) label(mount string) string {
+	if c.legacyLabel {
+		return collector.LegacyLabel(mount)
+	}
+	return mount
+}
+
+// update lists the clients of every stream and counts the changes since the
+// previous poll
+func (c *listenerChurn) update(streams []collector.Stream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	current := map[string]bool{}
+	for _, s := range streams {
+		current[s.Mount] = true
+		mount := "/" + s.Mount
+		if u, err := url.Parse(s.ListenURL); err == nil && u.Path != "" {
+			mount = u.Path
+		}
+
+		clients, err := c.admin.ListClients(ctx, c.server, mount)
+		if err != nil {
+			// keep the previous clients, the changes are counted with the
+			// next successful request
+			if err.Error() != c.lastErr {
+				log.Printf("Error listing clients of %s on %s: %v", mount, c.target, err)
+			}
+			c.lastErr = err.Error()
+			continue
+		}
+		c.lastErr = ""
+
+		ids := map[string]bool{}
+		for _, l := range clients {
+			ids[l.Key()] = true
+		}
+		label := c.label(s.Mount)
+		// the clients of a mount seen for the first time are only counted
+		// from the next poll on
+		if previous, ok := c.clients[s.Mount]; ok {
+			for id := range ids {
+				if !previous[id] {
+					listenerConnects.WithLabelValues(c.target, label).Inc()
+				}
+			}
+			for id := range previous {
+				if !ids[id] {
+					listenerDisconnects.WithLabelValues(c.target, label).Inc()
+				}
+			}
+		} else {
+			listenerConnects.WithLabelValues(c.target, label)
+			listenerDisconnects.WithLabelValues(c.target, label)
+		}
+		c.clients[s.Mount] = ids
+	}
+
+	// all listeners of a vanished mount are gone with its source
+	for mount, previous := range c.clients {
+		if !current[mount] && len(previous) > 0 {
+			listenerDisconnects.WithLabelValues(c.target, c.label(mount)).Add(float64(len(previous)))
+			c.clients[mount] = map[string]bool{}
+		}
+	}
+}
+
+// delete removes the counters of the target
+func (c *listenerChurn) delete() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for mount := range c.clients {
+		listenerConnects.DeleteLabelValues(c.target, c.label(mount))
+		listenerDisconnects.DeleteLabelValues(c.target, c.label(mount))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+var clusterListenersDesc = prometheus.NewDesc("icecast_cluster_listeners",
+	"Listeners of a mount summed up across all edges of a cluster", []string{"cluster", "mount"}, nil)
+
+// ClusterConfig configures identical Icecast edges, e.g. behind round-robin
+// DNS. Every edge is polled as its own target with the options of the cluster
+type ClusterConfig struct {
+	Name string `yaml:"name"`
+	// status URLs of the edges, each reachable on its own
+	Edges []string `yaml:"edges"`
+	// options of all edges, its url is unused
+	TargetConfig `yaml:",inline"`
+}
+
+// targets returns a target per edge, labeled with the host of the edge to
+// keep their series apart
+func (c ClusterConfig) targets() []TargetConfig {
+	var targets []TargetConfig
+	for _, edge := range c.Edges {
+		t := c.TargetConfig
+		t.URL = edge
+		t.Cluster = c.Name
+		t.Labels = map[string]string{}
+		for name, value := range c.Labels {
+			t.Labels[name] = value
+		}
+		if u, err := url.Parse(edge); err == nil && u.Host != "" {
+			t.Labels["edge"] = u.Host
+		}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// clusterCollector exports the listeners of the mounts of each cluster summed
+// up across its edges
+type clusterCollector struct {
+	pollers     func() []*poller
+	legacyLabel bool
+	// export the oldest poll of the edges as timestamp
+	timestamps bool
+}
+
+func (c *clusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clusterListenersDesc
+}
+
+func (c *clusterCollector) Collect(ch chan<- prometheus.Metric) {
+	listeners := map[string]map[string]int{}
+	polledAt := map[string]time.Time{}
+	for _, p := range c.pollers() {
+		if p.cluster == "" {
+			continue
+		}
+		if t := p.lastPoll(); !t.IsZero() && (polledAt[p.cluster].IsZero() || t.Before(polledAt[p.cluster])) {
+			polledAt[p.cluster] = t
+		}
+		mounts := listeners[p.cluster]
+		if mounts == nil {
+			mounts = map[string]int{}
+			listeners[p.cluster] = mounts
+		}
+		// edges may list a mount more than once, e.g. with another host in
+		// the listen URL
+		seen := map[string]bool{}
+		for _, s := range p.lastStreams() {
+			mount := clusterMount(s)
+			if seen[mount] {
+				continue
+			}
+			seen[mount] = true
+			mounts[mount] += s.Listeners
+		}
+	}
+
+	clusters := make([]string, 0, len(listeners))
+	for cluster := range listeners {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		for mount, n := range listeners[cluster] {
+			if c.legacyLabel {
+				mount = collector.LegacyLabel(mount)
+			}
+			m := prometheus.MustNewConstMetric(clusterListenersDesc, prometheus.GaugeValue, float64(n), cluster, mount)
+			if c.timestamps && !polledAt[cluster].IsZero() {
+				m = prometheus.NewMetricWithTimestamp(polledAt[cluster], m)
+			}
+			ch <- m
+		}
+	}
+}
+
+// clusterMount identifies a mount across edges by the path of its listen URL,
+// which differ in their host
+func clusterMount(s collector.Stream) string {
+	u, err := url.Parse(s.ListenURL)
+	if err != nil || strings.Trim(u.Path, "/") == "" {
+		return s.Mount
+	}
+	return strings.TrimPrefix(u.Path, "/")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type Config struct {
+	Targets    []TargetConfig    `yaml:"targets"`
+	Publishers []PublisherConfig `yaml:"publishers"`
+	Clocks     []ClockConfig     `yaml:"clocks"`
+	Alerts     []AlertConfig     `yaml:"alerts"`
+	// mounts that should always be connected, see Notifiers
+	ExpectedMounts []string         `yaml:"expected_mounts"`
+	Notifiers      []NotifierConfig `yaml:"notifiers"`
+	// expected encoder settings of mounts
+	Profiles []ProfileConfig `yaml:"profiles"`
+	// edges aggregated per cluster, added to the targets
+	Clusters []ClusterConfig `yaml:"clusters"`
+}
+
+// TargetConfig configures an Icecast target, unset options default to the
+// corresponding flags
+type TargetConfig struct {
+	URL    string `yaml:"url"`
+	Filter string `yaml:"filter"`
+	// additional labels of all series of the target
+	Labels   map[string]string `yaml:"labels"`
+	Interval time.Duration     `yaml:"interval"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	// basic auth
+	Username string    `yaml:"username"`
+	Password string    `yaml:"password"`
+	TLS      TLSConfig `yaml:"tls"`
+	// unix socket to connect to instead of the host of the URL, which is
+	// still used for the Host header and the labels
+	UnixSocket string `yaml:"unix_socket"`
+	// mounts polled more often than the target
+	Mounts []MountConfig `yaml:"mounts"`
+	// mounts relayed from a master, their connection is tracked
+	Relays []string `yaml:"relays"`
+	// admin credentials, enable the listener churn counters
+	AdminUsername string `yaml:"admin_username"`
+	AdminPassword string `yaml:"admin_password"`
+	// admin stats counting the listener authentication of the mounts
+	AuthStats AuthStatsConfig `yaml:"auth_stats"`
+	// name of the cluster of an edge, only set by the clusters
+	Cluster string `yaml:"-"`
+}
+
+type TLSConfig struct {
+	CAFile     string `yaml:"ca_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
+	// a pointer to tell an explicit false from an unset option
+	InsecureSkipVerify *bool `yaml:"insecure_skip_verify"`
+}
+
+// withDefaults returns the target with all unset options taken from defaults,
+// the client certificate and key are only taken together
+func (t TargetConfig) withDefaults(defaults TargetConfig) TargetConfig {
+	if t.Filter == "" {
+		t.Filter = defaults.Filter
+	}
+	if t.Interval == 0 {
+		t.Interval = defaults.Interval
+	}
+	if t.Timeout == 0 {
+		t.Timeout = defaults.Timeout
+	}
+	if t.Username == "" && t.Password == "" {
+		t.Username, t.Password = defaults.Username, defaults.Password
+	}
+	if t.UnixSocket == "" {
+		t.UnixSocket = defaults.UnixSocket
+	}
+	if t.AdminUsername == "" {
+		t.AdminUsername = defaults.AdminUsername
+	}
+	if t.AdminPassword == "" {
+		t.AdminPassword = defaults.AdminPassword
+	}
+	if t.AuthStats.Success == "" && t.AuthStats.Failures == "" {
+		t.AuthStats = defaults.AuthStats
+	}
+	if t.TLS.CAFile == "" {
+		t.TLS.CAFile = defaults.TLS.CAFile
+	}
+	if t.TLS.CertFile == "" && t.TLS.KeyFile == "" {
+		t.TLS.CertFile, t.TLS.KeyFile = defaults.TLS.CertFile, defaults.TLS.KeyFile
+	}
+	if t.TLS.ServerName == "" {
+		t.TLS.ServerName = defaults.TLS.ServerName
+	}
+	if t.TLS.InsecureSkipVerify == nil {
+		t.TLS.InsecureSkipVerify = defaults.TLS.InsecureSkipVerify
+	}
+	return t
+}
+
+func (c TLSConfig) config() (*tls.Config, error) {
+	config := &tls.Config{ServerName: c.ServerName}
+	if c.InsecureSkipVerify != nil {
+		config.InsecureSkipVerify = *c.InsecureSkipVerify
+	}
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := new(Config)
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	for i, t := range config.Targets {
+		if t.URL == "" {
+			return nil, fmt.Errorf("error parsing config file %s: target %d has no url", path, i+1)
+		}
+	}
+	for i, c := range config.Clusters {
+		if c.Name == "" || len(c.Edges) == 0 {
+			return nil, fmt.Errorf("error parsing config file %s: cluster %d needs a name and edges", path, i+1)
+		}
+		if c.URL != "" {
+			return nil, fmt.Errorf("error parsing config file %s: cluster %d has a url, edges are listed as edges", path, i+1)
+		}
+		config.Targets = append(config.Targets, c.targets()...)
+	}
+	for i, p := range config.Publishers {
+		if p.URL == "" {
+			return nil, fmt.Errorf("error parsing config file %s: publisher %d has no url", path, i+1)
+		}
+	}
+	return config, nil
+}
+
+// parseList parses a comma separated list, dropping empty entries
+func parseList(s string) []string {
+	var list []string
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// parseLabelPairs parses a comma separated list of name=value pairs
+func parseLabelPairs(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	if s == "" {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid label pair %q, expected name=value", pair)
+		}
+		labels[name] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
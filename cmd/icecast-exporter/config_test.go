@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"mp3", []string{"mp3"}},
+		{"a, b", []string{"a", "b"}},
+		{" a ,, b ,", []string{"a", "b"}},
+		{" , ", nil},
+	}
+	for _, tt := range tests {
+		if got := parseList(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseLabelPairs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"instance=relay1", map[string]string{"instance": "relay1"}, false},
+		{"instance = relay1, site=berlin", map[string]string{"instance": "relay1", "site": "berlin"}, false},
+		{"Authorization=Bearer a=b", map[string]string{"Authorization": "Bearer a=b"}, false},
+		{"instance", nil, true},
+		{"=relay1", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseLabelPairs(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLabelPairs(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLabelPairs(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// consulWait is the maximum duration of a blocking query, Consul answers
+// early as soon as the instances of the service change
+const consulWait = time.Minute
+
+type consulOptions struct {
+	address string
+	service string
+	tag     string
+	token   string
+	scheme  string
+}
+
+// consulEntry is the part of an entry of /v1/health/service used for discovery
+type consulEntry struct {
+	Node struct {
+		Node    string
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// instances returns the passing instances of the service, index is used for
+// a blocking query and the index of the response is returned
+func (c consulOptions) instances(client *http.Client, index string) ([]TargetConfig, string, error) {
+	query := url.Values{"passing": {"1"}, "wait": {consulWait.String()}}
+	if c.tag != "" {
+		query.Set("tag", c.tag)
+	}
+	if index != "" {
+		query.Set("index", index)
+	}
+	endpoint := strings.TrimSuffix(c.address, "/") + "/v1/health/service/" + url.PathEscape(c.service) + "?" + query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, "", fmt.Errorf("error decoding Consul response: %w", err)
+	}
+
+	var targets []TargetConfig
+	for _, e := range entries {
+		// instances registered without address use the address of their node
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		address := net.JoinHostPort(host, strconv.Itoa(e.Service.Port))
+		targets = append(targets, TargetConfig{
+			URL:    c.scheme + "://" + address + defaultStatusPath,
+			Labels: map[string]string{"node": e.Node.Node},
+		})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].URL < targets[j].URL })
+	return targets, resp.Header.Get("X-Consul-Index"), nil
+}
+
+// discoverConsul watches the instances of the service with blocking queries
+// and updates the targets, errors keep the previous targets
+func discoverConsul(c consulOptions, targets *targetManager) error {
+	client := &http.Client{Timeout: consulWait + 10*time.Second}
+
+	found, index, err := c.instances(client, "")
+	if err != nil {
+		return fmt.Errorf("error querying Consul service %s: %w", c.service, err)
+	}
+	log.Println("discovered", len(found), "targets in Consul service", c.service)
+	targets.sync("consul", found)
+
+	go func() {
+		retry := newBackoff(time.Second, time.Minute)
+		last := len(found)
+		for {
+			found, next, err := c.instances(client, index)
+			if err != nil {
+				delay := retry.fail()
+				log.Printf("Error querying Consul service %s: %v, trying again in %s", c.service, err, delay.Round(time.Second))
+				time.Sleep(delay)
+				continue
+			}
+
+			// a timed out blocking query returns the same index
+			if next != "" && next == index {
+				retry.reset()
+				continue
+			}
+			// the index goes backwards when Consul is restored from a
+			// snapshot, start over without blocking
+			prev, _ := strconv.ParseUint(index, 10, 64)
+			if n, _ := strconv.ParseUint(next, 10, 64); n == 0 || n < prev {
+				next = ""
+			}
+			if next != "" || len(found) != last {
+				log.Println("discovered", len(found), "targets in Consul service", c.service)
+			}
+			index = next
+			last = len(found)
+			targets.sync("consul", found)
+
+			// without an index the next query does not block, e.g. behind a
+			// proxy dropping X-Consul-Index, so wait instead of flooding Consul
+			if index == "" {
+				time.Sleep(retry.fail())
+			} else {
+				retry.reset()
+			}
+		}
+	}()
+	return nil
+}
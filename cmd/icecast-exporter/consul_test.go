@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestConsulInstances(t *testing.T) {
+	var query, token, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		query = r.URL.RawQuery
+		token = r.Header.Get("X-Consul-Token")
+		w.Header().Set("X-Consul-Index", "42")
+		w.Write([]byte(`[
+			{"Node": {"Node": "node2", "Address": "10.0.0.2"}, "Service": {"Address": "", "Port": 8000}},
+			{"Node": {"Node": "node1", "Address": "10.0.0.1"}, "Service": {"Address": "192.168.0.1", "Port": 8443}},
+			{"Node": {"Node": "node3", "Address": "fd00::3"}, "Service": {"Port": 8000}}
+		]`))
+	}))
+	defer server.Close()
+
+	c := consulOptions{address: server.URL + "/", service: "icecast", tag: "relay", token: "secret", scheme: "http"}
+	targets, index, err := c.instances(server.Client(), "41")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/health/service/icecast" {
+		t.Errorf("path = %q", path)
+	}
+	if want := "index=41&passing=1&tag=relay&wait=1m0s"; query != want {
+		t.Errorf("query = %q, want %q", query, want)
+	}
+	if token != "secret" {
+		t.Errorf("token = %q, want secret", token)
+	}
+	if index != "42" {
+		t.Errorf("index = %q, want 42", index)
+	}
+	want := []TargetConfig{
+		{URL: "http://10.0.0.2:8000/status-json.xsl", Labels: map[string]string{"node": "node2"}},
+		{URL: "http://192.168.0.1:8443/status-json.xsl", Labels: map[string]string{"node": "node1"}},
+		{URL: "http://[fd00::3]:8000/status-json.xsl", Labels: map[string]string{"node": "node3"}},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("instances() = %+v, want %+v", targets, want)
+	}
+}
+
+func TestConsulInstancesErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"status", http.StatusForbidden, `[]`},
+		{"decoding", http.StatusOK, `{"not": "a list"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := consulOptions{address: server.URL, service: "icecast", scheme: "http"}
+			if _, _, err := c.instances(server.Client(), ""); err == nil {
+				t.Error("instances() returned no error")
+			}
+		})
+	}
+}
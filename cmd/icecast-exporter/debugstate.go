@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// pollResult is the outcome of the last poll of a target, stored by the poll
+// loop and read by the debug state
+type pollResult struct {
+	at       time.Time
+	err      string
+	failures int
+	retryAt  time.Time
+}
+
+type debugTarget struct {
+	URL      string            `json:"url"`
+	Provider string            `json:"provider"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Cluster  string            `json:"cluster,omitempty"`
+	Interval string            `json:"interval"`
+	Timeout  string            `json:"timeout"`
+	// omitted before the first poll
+	LastPoll       *time.Time `json:"last_poll,omitempty"`
+	LastSuccess    *time.Time `json:"last_success,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	FailedPolls    int        `json:"failed_polls"`
+	RetryAt        *time.Time `json:"retry_at,omitempty"`
+	Streams        int        `json:"streams"`
+	Listeners      int        `json:"listeners"`
+	MountIntervals int        `json:"mount_intervals,omitempty"`
+	ChurnCounters  bool       `json:"churn_counters"`
+	RelaysTracked  int        `json:"relays_tracked,omitempty"`
+	AuthCounters   bool       `json:"auth_counters"`
+}
+
+type debugQueue struct {
+	Name     string `json:"name"`
+	Length   int    `json:"length"`
+	Capacity int    `json:"capacity"`
+}
+
+type debugPublisher struct {
+	Type   string       `json:"type"`
+	Queues []debugQueue `json:"queues,omitempty"`
+}
+
+type debugState struct {
+	Started    time.Time        `json:"started"`
+	Targets    []debugTarget    `json:"targets"`
+	Publishers []debugPublisher `json:"publishers"`
+}
+
+// queueReporter is implemented by publishers sending through queues
+type queueReporter interface {
+	queues() []debugQueue
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// redactURL masks the password of a URL with credentials
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Redacted()
+}
+
+// publisherType names a publisher by its type, e.g. webhookPublisher
+func publisherType(pub streamPublisher) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", pub), "*main.")
+}
+
+// debugStateHandler serves the internal state of the targets and publishers
+// as JSON for introspecting a running exporter
+func debugStateHandler(targets *targetManager, publishers []streamPublisher, started time.Time) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		state := debugState{Started: started, Targets: []debugTarget{}, Publishers: []debugPublisher{}}
+		for _, p := range targets.pollers() {
+			result, _ := p.result.Load().(pollResult)
+			t := debugTarget{
+				URL:         redactURL(p.url),
+				Provider:    targets.provider(p.url),
+				Labels:      p.labels,
+				Cluster:     p.cluster,
+				Interval:    p.interval.String(),
+				Timeout:     p.timeout.String(),
+				LastPoll:    timeOrNil(result.at),
+				LastSuccess: timeOrNil(p.lastPoll()),
+				// errors of the HTTP client contain the URL as well
+				LastError:      strings.ReplaceAll(result.err, p.url, redactURL(p.url)),
+				FailedPolls:    result.failures,
+				RetryAt:        timeOrNil(result.retryAt),
+				MountIntervals: len(p.mounts),
+				ChurnCounters:  p.churn != nil,
+				AuthCounters:   p.auth != nil,
+			}
+			if p.relays != nil {
+				t.RelaysTracked = len(p.relays.mounts)
+			}
+			for _, s := range p.lastStreams() {
+				t.Streams++
+				t.Listeners += s.Listeners
+			}
+			state.Targets = append(state.Targets, t)
+		}
+		for _, pub := range publishers {
+			d := debugPublisher{Type: publisherType(pub)}
+			if q, ok := pub.(queueReporter); ok {
+				d.Queues = q.queues()
+			}
+			state.Publishers = append(state.Publishers, d)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(state); err != nil {
+			log.Println("Error writing debug state:", err)
+		}
+	})
+}
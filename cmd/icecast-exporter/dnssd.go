@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lookupSRVTargets resolves an SRV name like _icecast._tcp.example.com into
+// one target per backend, labeled with the resolved host
+func lookupSRVTargets(name, scheme string) ([]TargetConfig, error) {
+	_, records, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []TargetConfig
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		if host == "" {
+			continue
+		}
+		address := net.JoinHostPort(host, strconv.Itoa(int(r.Port)))
+		targets = append(targets, TargetConfig{
+			URL:    scheme + "://" + address + defaultStatusPath,
+			Labels: map[string]string{"host": host},
+		})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].URL < targets[j].URL })
+	return targets, nil
+}
+
+// discoverSRV resolves the SRV name every interval and updates the targets, a
+// failed lookup keeps the previous targets
+func discoverSRV(name, scheme string, interval time.Duration, targets *targetManager) error {
+	found, err := lookupSRVTargets(name, scheme)
+	if err != nil {
+		return fmt.Errorf("error resolving SRV record %s: %w", name, err)
+	}
+	log.Println("discovered", len(found), "targets at", name)
+	targets.sync("dns", found)
+
+	go func() {
+		last := len(found)
+		for {
+			time.Sleep(interval)
+			found, err := lookupSRVTargets(name, scheme)
+			if err != nil {
+				log.Printf("Error resolving SRV record %s: %v", name, err)
+				continue
+			}
+			if len(found) != last {
+				log.Println("discovered", len(found), "targets at", name)
+				last = len(found)
+			}
+			targets.sync("dns", found)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	dockerLabelScrape = "icecast-exporter.scrape"
+	dockerLabelPort   = "icecast-exporter.port"
+	dockerLabelPath   = "icecast-exporter.path"
+)
+
+// dockerClient talks to the Docker engine API over its unix socket
+type dockerClient struct {
+	client *http.Client
+}
+
+func newDockerClient(socket string) *dockerClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &dockerClient{client: &http.Client{Transport: transport}}
+}
+
+func (d *dockerClient) get(ctx context.Context, path string) (*http.Response, error) {
+	// the host is ignored by the unix socket dialer
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+type dockerContainer struct {
+	Names           []string
+	Labels          map[string]string
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string
+		}
+	}
+}
+
+// address returns the IP of the container, containers with host networking
+// have none and are reached on localhost
+func (c dockerContainer) address() string {
+	var networks []string
+	for name := range c.NetworkSettings.Networks {
+		networks = append(networks, name)
+	}
+	sort.Strings(networks)
+	for _, name := range networks {
+		if ip := c.NetworkSettings.Networks[name].IPAddress; ip != "" {
+			return ip
+		}
+	}
+	return "localhost"
+}
+
+func dockerFilter(filters map[string][]string) string {
+	b, _ := json.Marshal(filters)
+	return url.QueryEscape(string(b))
+}
+
+// targets lists the running containers labeled for scraping
+func (d *dockerClient) targets() ([]TargetConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resp, err := d.get(ctx, "/containers/json?filters="+dockerFilter(map[string][]string{"label": {dockerLabelScrape + "=true"}}))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("error decoding Docker containers: %w", err)
+	}
+
+	var targets []TargetConfig
+	for _, c := range containers {
+		port := c.Labels[dockerLabelPort]
+		if port == "" {
+			port = "8000"
+		}
+		path := c.Labels[dockerLabelPath]
+		if path == "" {
+			path = defaultStatusPath
+		}
+		var name string
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		targets = append(targets, TargetConfig{
+			URL:    "http://" + net.JoinHostPort(c.address(), port) + path,
+			Labels: map[string]string{"container": name},
+		})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].URL < targets[j].URL })
+	return targets, nil
+}
+
+// events blocks until the event stream ends and calls changed for every
+// start or stop of a container
+func (d *dockerClient) events(changed func()) error {
+	filters := map[string][]string{
+		"type":  {"container"},
+		"event": {"start", "die"},
+		"label": {dockerLabelScrape + "=true"},
+	}
+	resp, err := d.get(context.Background(), "/events?filters="+dockerFilter(filters))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// one JSON object per event, the content is not needed since the
+	// containers are listed again
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		changed()
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("event stream closed")
+}
+
+// discoverDocker lists the labeled containers and lists them again whenever
+// a container starts or stops
+func discoverDocker(socket string, targets *targetManager) error {
+	d := newDockerClient(socket)
+
+	update := func() error {
+		found, err := d.targets()
+		if err != nil {
+			return err
+		}
+		log.Println("discovered", len(found), "Docker containers")
+		targets.sync("docker", found)
+		return nil
+	}
+	if err := update(); err != nil {
+		return fmt.Errorf("error listing Docker containers: %w", err)
+	}
+
+	go func() {
+		retry := newBackoff(time.Second, time.Minute)
+		for {
+			err := d.events(func() {
+				retry.reset()
+				if err := update(); err != nil {
+					log.Println("Error listing Docker containers:", err)
+				}
+			})
+			delay := retry.fail()
+			log.Printf("Error watching Docker events: %v, trying again in %s", err, delay.Round(time.Second))
+			time.Sleep(delay)
+			// events during the reconnect are missed
+			if err := update(); err != nil {
+				log.Println("Error listing Docker containers:", err)
+			}
+		}
+	}()
+	return nil
+}
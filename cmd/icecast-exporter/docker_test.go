@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDockerTargets(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix sockets are not available:", err)
+	}
+
+	var filters string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filters = r.URL.Query().Get("filters")
+		w.Write([]byte(`[
+			{"Names": ["/icecast"], "Labels": {"icecast-exporter.scrape": "true"},
+			 "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2"}, "another": {"IPAddress": ""}}}},
+			{"Names": ["/relay"], "Labels": {"icecast-exporter.scrape": "true", "icecast-exporter.port": "8443", "icecast-exporter.path": "/stats.json"},
+			 "NetworkSettings": {"Networks": {"a": {"IPAddress": ""}, "b": {"IPAddress": "172.18.0.3"}}}},
+			{"Names": ["/host"], "Labels": {"icecast-exporter.scrape": "true"},
+			 "NetworkSettings": {"Networks": {"host": {"IPAddress": ""}}}}
+		]`))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	got, err := newDockerClient(socket).targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"label":["icecast-exporter.scrape=true"]}`; filters != want {
+		t.Errorf("filters = %q, want %q", filters, want)
+	}
+	want := []TargetConfig{
+		{URL: "http://172.17.0.2:8000/status-json.xsl", Labels: map[string]string{"container": "icecast"}},
+		{URL: "http://172.18.0.3:8443/stats.json", Labels: map[string]string{"container": "relay"}},
+		{URL: "http://localhost:8000/status-json.xsl", Labels: map[string]string{"container": "host"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("targets() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v2"
+)
+
+const defaultStatusPath = "/status-json.xsl"
+
+// fileSDGroup is a target group in the Prometheus file_sd format
+type fileSDGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// sdTargetURL returns the status URL of a discovered target, host:port
+// targets are completed with the __scheme__ and __metrics_path__ labels
+func sdTargetURL(target string, labels map[string]string) string {
+	if strings.Contains(target, "://") {
+		return target
+	}
+	scheme := labels["__scheme__"]
+	if scheme == "" {
+		scheme = "http"
+	}
+	path := labels["__metrics_path__"]
+	if path == "" {
+		path = defaultStatusPath
+	}
+	return scheme + "://" + target + path
+}
+
+// sdLabels returns the labels added to the series of a discovered target,
+// dropping meta labels and those used by the exporter itself
+func sdLabels(labels map[string]string) map[string]string {
+	out := map[string]string{}
+	for name, value := range labels {
+		switch {
+		case strings.HasPrefix(name, "__"):
+		case name == "server_name" || name == "stream_url":
+			log.Printf("Ignoring discovered label %s, it is set by the exporter", name)
+		default:
+			out[name] = value
+		}
+	}
+	return out
+}
+
+// loadTargetsFile reads a file_sd style JSON or YAML list of target groups
+func loadTargetsFile(path string) ([]TargetConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, so a single parser handles both formats
+	var groups []fileSDGroup
+	if err := yaml.UnmarshalStrict(data, &groups); err != nil {
+		return nil, fmt.Errorf("error parsing targets file %s: %w", path, err)
+	}
+
+	var targets []TargetConfig
+	for _, g := range groups {
+		labels := sdLabels(g.Labels)
+		for _, t := range g.Targets {
+			if t == "" {
+				continue
+			}
+			targets = append(targets, TargetConfig{URL: sdTargetURL(t, g.Labels), Labels: labels})
+		}
+	}
+	return targets, nil
+}
+
+// watchTargetsFile loads the targets file and reloads it whenever it changes,
+// a broken file keeps the previous targets
+func watchTargetsFile(path string, targets *targetManager) error {
+	loaded, err := loadTargetsFile(path)
+	if err != nil {
+		return err
+	}
+	log.Println("discovered", len(loaded), "targets in", path)
+	targets.sync("file", loaded)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// watch the directory since editors and config management replace the
+	// file instead of writing to it, which ends a watch on the file itself
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		clean := filepath.Clean(path)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != clean || event.Op == fsnotify.Chmod {
+					continue
+				}
+				loaded, err := loadTargetsFile(path)
+				if err != nil {
+					if !os.IsNotExist(err) {
+						log.Println("Error reloading targets:", err)
+					}
+					continue
+				}
+				log.Println("discovered", len(loaded), "targets in", path)
+				targets.sync("file", loaded)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("Error watching targets file:", err)
+			}
+		}
+	}()
+	return nil
+}
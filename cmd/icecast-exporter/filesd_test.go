@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSDTargetURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		labels map[string]string
+		want   string
+	}{
+		{"host and port", "icecast1:8000", nil, "http://icecast1:8000/status-json.xsl"},
+		{"scheme and path", "icecast1:8443", map[string]string{"__scheme__": "https", "__metrics_path__": "/admin/stats.json"}, "https://icecast1:8443/admin/stats.json"},
+		{"full URL", "https://relay.example.com/status-json.xsl", map[string]string{"__scheme__": "http"}, "https://relay.example.com/status-json.xsl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sdTargetURL(tt.target, tt.labels); got != tt.want {
+				t.Errorf("sdTargetURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSDLabels(t *testing.T) {
+	got := sdLabels(map[string]string{
+		"site":             "berlin",
+		"__scheme__":       "https",
+		"__meta_something": "x",
+		"server_name":      "ignored",
+		"stream_url":       "ignored",
+	})
+	if want := map[string]string{"site": "berlin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sdLabels() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadTargetsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []TargetConfig
+		wantErr bool
+	}{
+		{
+			"yaml",
+			`
+- targets: ["icecast1:8000", "", "icecast2:8000"]
+  labels:
+    site: berlin
+- targets: ["https://relay.example.com/status-json.xsl"]
+`,
+			[]TargetConfig{
+				{URL: "http://icecast1:8000/status-json.xsl", Labels: map[string]string{"site": "berlin"}},
+				{URL: "http://icecast2:8000/status-json.xsl", Labels: map[string]string{"site": "berlin"}},
+				{URL: "https://relay.example.com/status-json.xsl", Labels: map[string]string{}},
+			},
+			false,
+		},
+		{
+			"json",
+			`[{"targets": ["icecast1:8443"], "labels": {"__scheme__": "https", "site": "hamburg"}}]`,
+			[]TargetConfig{{URL: "https://icecast1:8443/status-json.xsl", Labels: map[string]string{"site": "hamburg"}}},
+			false,
+		},
+		{"empty", `[]`, nil, false},
+		{"unknown field", `[{"targets": ["icecast1:8000"], "label": {}}]`, nil, true},
+		{"not a list", `targets: []`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "targets.yml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadTargetsFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTargetsFile() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadTargetsFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+)
+
+type graphiteOptions struct {
+	address string
+	prefix  string
+}
+
+const graphiteTimeout = 10 * time.Second
+
+// send writes all metrics using the carbon plaintext protocol, label values
+// become part of the path, e.g. icecast.Example_Radio.live_mp3.listeners
+func (o graphiteOptions) send() error {
+	samples, err := gatherSamples(reg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", o.address, graphiteTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(graphiteTimeout))
+
+	_, err = conn.Write(graphiteLines(o.prefix, samples, time.Now().Unix()))
+	return err
+}
+
+// graphiteLines encodes samples in the carbon plaintext protocol
+func graphiteLines(prefix string, samples []sample, timestamp int64) []byte {
+	var buf bytes.Buffer
+	for _, s := range samples {
+		fmt.Fprintf(&buf, "%s %g %d\n", metricPath(prefix, s, true), s.value, timestamp)
+	}
+	return buf.Bytes()
+}
+
+// sendGraphite periodically sends all metrics to a Graphite carbon receiver
+func sendGraphite(opts graphiteOptions, interval time.Duration, refresh func()) {
+	runOutput("Graphite", interval, refresh, opts.send)
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestGraphiteLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		samples []sample
+		want    string
+	}{
+		{"no samples", "icecast", nil, ""},
+		{
+			"label values in the path",
+			"icecast",
+			[]sample{listenerSample("Example Radio", "live.mp3", 12)},
+			"icecast.Example_Radio.live_mp3.listeners 12 1700000000\n",
+		},
+		{
+			"fractions",
+			"",
+			[]sample{{name: "icecast_scrape_duration_seconds", value: 0.25}},
+			"scrape_duration_seconds 0.25 1700000000\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(graphiteLines(tt.prefix, tt.samples, 1700000000)); got != tt.want {
+				t.Errorf("graphiteLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
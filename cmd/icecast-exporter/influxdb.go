@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type influxOptions struct {
+	url string
+	// 1 uses the /write API with database and basic auth, 2 the /api/v2/write
+	// API with org, bucket and token
+	version  int
+	database string
+	username string
+	password string
+	token    string
+	org      string
+	bucket   string
+}
+
+var (
+	influxClient = &http.Client{Timeout: 30 * time.Second}
+
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// influxLines encodes samples in line protocol with the metric name as measurement,
+// the labels as tags and a single value field
+func influxLines(samples []sample, timestamp int64) []byte {
+	var buf bytes.Buffer
+	for _, s := range samples {
+		buf.WriteString(influxMeasurementEscaper.Replace(s.name))
+		for _, l := range s.labels {
+			// empty tag values are not allowed in line protocol
+			if l.GetValue() == "" {
+				continue
+			}
+			fmt.Fprintf(&buf, ",%s=%s", influxTagEscaper.Replace(l.GetName()), influxTagEscaper.Replace(l.GetValue()))
+		}
+		fmt.Fprintf(&buf, " value=%g %d\n", s.value, timestamp)
+	}
+	return buf.Bytes()
+}
+
+func (o influxOptions) writeURL() string {
+	params := url.Values{"precision": {"s"}}
+	path := "/api/v2/write"
+	if o.version == 1 {
+		path = "/write"
+		params.Set("db", o.database)
+	} else {
+		params.Set("org", o.org)
+		params.Set("bucket", o.bucket)
+	}
+	return strings.TrimSuffix(o.url, "/") + path + "?" + params.Encode()
+}
+
+func (o influxOptions) write() error {
+	samples, err := gatherSamples(reg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, o.writeURL(), bytes.NewReader(influxLines(samples, time.Now().Unix())))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if o.version == 1 {
+		if o.username != "" {
+			req.SetBasicAuth(o.username, o.password)
+		}
+	} else if o.token != "" {
+		req.Header.Set("Authorization", "Token "+o.token)
+	}
+
+	resp, err := influxClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("unexpected HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// writeInflux periodically writes all metrics to InfluxDB
+func writeInflux(opts influxOptions, interval time.Duration, refresh func()) {
+	runOutput("InfluxDB", interval, refresh, opts.write)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestInfluxLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []sample
+		want    string
+	}{
+		{"no samples", nil, ""},
+		{
+			"tags escaped",
+			[]sample{listenerSample("Example Radio, Berlin", "a=b", 12)},
+			`icecast_listeners,server_name=Example\ Radio\,\ Berlin,stream_url=a\=b value=12 1700000000` + "\n",
+		},
+		{
+			"empty tags dropped",
+			[]sample{listenerSample("", "live.mp3", 3)},
+			"icecast_listeners,stream_url=live.mp3 value=3 1700000000\n",
+		},
+		{
+			"measurement escaped",
+			[]sample{{name: "a b,c", value: 0.5, typ: dto.MetricType_GAUGE}},
+			`a\ b\,c value=0.5 1700000000` + "\n",
+		},
+		{
+			"one line per sample",
+			[]sample{listenerSample("Radio", "live.mp3", 1), listenerSample("Radio", "live.ogg", 2)},
+			"icecast_listeners,server_name=Radio,stream_url=live.mp3 value=1 1700000000\n" +
+				"icecast_listeners,server_name=Radio,stream_url=live.ogg value=2 1700000000\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(influxLines(tt.samples, 1700000000)); got != tt.want {
+				t.Errorf("influxLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfluxWriteURL(t *testing.T) {
+	tests := []struct {
+		name string
+		opts influxOptions
+		want string
+	}{
+		{"version 1", influxOptions{url: "http://influxdb:8086/", version: 1, database: "icecast"}, "http://influxdb:8086/write?db=icecast&precision=s"},
+		{"version 2", influxOptions{url: "http://influxdb:8086", version: 2, org: "radio", bucket: "icecast"}, "http://influxdb:8086/api/v2/write?bucket=icecast&org=radio&precision=s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.writeURL(); got != tt.want {
+				t.Errorf("writeURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+type kubernetesOptions struct {
+	// path of a kubeconfig, empty for the in-cluster config
+	kubeconfig string
+	// pod or service
+	role      string
+	namespace string
+	selector  string
+	port      int
+}
+
+// kubeClient talks to the Kubernetes API server
+type kubeClient struct {
+	server string
+	client *http.Client
+	// returns the bearer token of a request, the token of a service account
+	// is read on every request since it is rotated
+	token func() (string, error)
+}
+
+func (k *kubeClient) get(path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(k.server, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if k.token != nil {
+		token, err := k.token()
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func inClusterClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster, set --kubernetes.kubeconfig")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := kubeTLSConfig(ca, nil, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return &kubeClient{
+		server: "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		token: func() (string, error) {
+			token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+			return strings.TrimSpace(string(token)), err
+		},
+	}, nil
+}
+
+// kubeconfig is the part of a kubeconfig file needed to reach the API
+// server of the current context, exec and auth provider plugins are not
+// supported
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// kubeconfigData returns inline base64 data or the content of a file
+// relative to the kubeconfig
+func kubeconfigData(data, file, dir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	return os.ReadFile(file)
+}
+
+func kubeconfigClient(path string) (*kubeClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig %s: %w", path, err)
+	}
+
+	var clusterName, userName string
+	for _, c := range config.Contexts {
+		if c.Name == config.CurrentContext {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+		}
+	}
+	if clusterName == "" {
+		return nil, fmt.Errorf("kubeconfig %s has no current context", path)
+	}
+
+	client := &kubeClient{}
+	dir := filepath.Dir(path)
+	var ca, cert, key []byte
+	insecure := false
+	for _, c := range config.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		client.server = c.Cluster.Server
+		insecure = c.Cluster.InsecureSkipTLSVerify
+		if ca, err = kubeconfigData(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, dir); err != nil {
+			return nil, err
+		}
+	}
+	if client.server == "" {
+		return nil, fmt.Errorf("kubeconfig %s has no server for cluster %s", path, clusterName)
+	}
+	for _, u := range config.Users {
+		if u.Name != userName {
+			continue
+		}
+		token := u.User.Token
+		client.token = func() (string, error) { return token, nil }
+		if cert, err = kubeconfigData(u.User.ClientCertificateData, u.User.ClientCertificate, dir); err != nil {
+			return nil, err
+		}
+		if key, err = kubeconfigData(u.User.ClientKeyData, u.User.ClientKey, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig, err := kubeTLSConfig(ca, cert, key, insecure)
+	if err != nil {
+		return nil, err
+	}
+	client.client = &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	return client, nil
+}
+
+func kubeTLSConfig(ca, cert, key []byte, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if len(ca) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid Kubernetes CA certificate")
+		}
+	}
+	if len(cert) > 0 {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	return config, nil
+}
+
+type kubeList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Status struct {
+			Phase string `json:"phase"`
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+func (o kubernetesOptions) targets(k *kubeClient) ([]TargetConfig, error) {
+	resource := "pods"
+	if o.role == "service" {
+		resource = "services"
+	}
+	path := "/api/v1/" + resource
+	if o.namespace != "" {
+		path = "/api/v1/namespaces/" + url.PathEscape(o.namespace) + "/" + resource
+	}
+	if o.selector != "" {
+		path += "?labelSelector=" + url.QueryEscape(o.selector)
+	}
+
+	var list kubeList
+	if err := k.get(path, &list); err != nil {
+		return nil, err
+	}
+
+	var targets []TargetConfig
+	port := strconv.Itoa(o.port)
+	for _, item := range list.Items {
+		meta := item.Metadata
+		var host string
+		labels := map[string]string{"namespace": meta.Namespace}
+		if o.role == "service" {
+			host = meta.Name + "." + meta.Namespace + ".svc"
+			labels["service"] = meta.Name
+		} else {
+			// pending pods have no address and finished pods are not polled
+			if item.Status.Phase != "Running" || item.Status.PodIP == "" {
+				continue
+			}
+			host = item.Status.PodIP
+			labels["pod"] = meta.Name
+		}
+		targets = append(targets, TargetConfig{
+			URL:    "http://" + net.JoinHostPort(host, port) + defaultStatusPath,
+			Labels: labels,
+		})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].URL < targets[j].URL })
+	return targets, nil
+}
+
+// discoverKubernetes lists the matching pods or services every interval and
+// updates the targets, a failed request keeps the previous targets
+func discoverKubernetes(o kubernetesOptions, interval time.Duration, targets *targetManager) error {
+	if o.role != "pod" && o.role != "service" {
+		return fmt.Errorf("invalid --kubernetes.role %q, must be pod or service", o.role)
+	}
+	var k *kubeClient
+	var err error
+	if o.kubeconfig != "" {
+		k, err = kubeconfigClient(o.kubeconfig)
+	} else {
+		k, err = inClusterClient()
+	}
+	if err != nil {
+		return err
+	}
+
+	found, err := o.targets(k)
+	if err != nil {
+		return fmt.Errorf("error listing Kubernetes %ss: %w", o.role, err)
+	}
+	log.Printf("discovered %d Kubernetes %ss", len(found), o.role)
+	targets.sync("kubernetes", found)
+
+	go func() {
+		last := len(found)
+		for {
+			time.Sleep(interval)
+			found, err := o.targets(k)
+			if err != nil {
+				log.Printf("Error listing Kubernetes %ss: %v", o.role, err)
+				continue
+			}
+			if len(found) != last {
+				log.Printf("discovered %d Kubernetes %ss", len(found), o.role)
+				last = len(found)
+			}
+			targets.sync("kubernetes", found)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const kubePods = `{"items": [
+	{"metadata": {"name": "icecast-1", "namespace": "streaming"}, "status": {"phase": "Running", "podIP": "10.1.0.5"}},
+	{"metadata": {"name": "icecast-2", "namespace": "streaming"}, "status": {"phase": "Pending", "podIP": ""}},
+	{"metadata": {"name": "icecast-0", "namespace": "streaming"}, "status": {"phase": "Succeeded", "podIP": "10.1.0.3"}},
+	{"metadata": {"name": "icecast-3", "namespace": "streaming"}, "status": {"phase": "Running", "podIP": "10.1.0.4"}}
+]}`
+
+const kubeServices = `{"items": [
+	{"metadata": {"name": "icecast", "namespace": "streaming"}}
+]}`
+
+func TestKubernetesTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     kubernetesOptions
+		body     string
+		wantPath string
+		want     []TargetConfig
+	}{
+		{
+			"running pods",
+			kubernetesOptions{role: "pod", namespace: "streaming", selector: "app=icecast", port: 8000},
+			kubePods,
+			"/api/v1/namespaces/streaming/pods?labelSelector=app%3Dicecast",
+			[]TargetConfig{
+				{URL: "http://10.1.0.4:8000/status-json.xsl", Labels: map[string]string{"namespace": "streaming", "pod": "icecast-3"}},
+				{URL: "http://10.1.0.5:8000/status-json.xsl", Labels: map[string]string{"namespace": "streaming", "pod": "icecast-1"}},
+			},
+		},
+		{
+			"services of all namespaces",
+			kubernetesOptions{role: "service", port: 8080},
+			kubeServices,
+			"/api/v1/services",
+			[]TargetConfig{
+				{URL: "http://icecast.streaming.svc:8080/status-json.xsl", Labels: map[string]string{"namespace": "streaming", "service": "icecast"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path, auth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.RequestURI()
+				auth = r.Header.Get("Authorization")
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			k := &kubeClient{server: server.URL, client: server.Client(), token: func() (string, error) { return "token", nil }}
+			got, err := tt.opts.targets(k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tt.wantPath {
+				t.Errorf("path = %q, want %q", path, tt.wantPath)
+			}
+			if auth != "Bearer token" {
+				t.Errorf("Authorization = %q, want Bearer token", auth)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targets() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubernetesTargetsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	k := &kubeClient{server: server.URL, client: server.Client()}
+	if _, err := (kubernetesOptions{role: "pod", port: 8000}).targets(k); err == nil {
+		t.Error("targets() returned no error")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+type debugResponse struct {
+	URL         string    `json:"url"`
+	Status      string    `json:"status"`
+	ContentType string    `json:"content_type"`
+	ReceivedAt  time.Time `json:"received_at"`
+	Body        string    `json:"body"`
+}
+
+// debugDiagnostics describe how the exporter parses the last response
+type debugDiagnostics struct {
+	ParseError string `json:"parse_error,omitempty"`
+	// shape of icestats.source: array, object, missing or the JSON type
+	Source string `json:"source"`
+	// entries of the source array, those that are no stream are skipped
+	Entries        int  `json:"entries"`
+	SkippedEntries int  `json:"skipped_entries"`
+	BlankTitleFix  bool `json:"blank_title_fix"`
+}
+
+type debugStream struct {
+	ListenURL  string `json:"listen_url"`
+	ServerName string `json:"server_name"`
+	// label of icecast_listeners, empty if the filter drops the stream
+	StreamURL string `json:"stream_url,omitempty"`
+	Listeners int    `json:"listeners"`
+	Filtered  bool   `json:"filtered,omitempty"`
+}
+
+type debugLastScrape struct {
+	Target string `json:"target"`
+	// outcome of the last poll, the response may belong to a mount poll
+	LastPoll    *time.Time        `json:"last_poll,omitempty"`
+	LastError   string            `json:"last_error,omitempty"`
+	Response    *debugResponse    `json:"response"`
+	Diagnostics *debugDiagnostics `json:"diagnostics,omitempty"`
+	Streams     []debugStream     `json:"streams,omitempty"`
+}
+
+// sourceShape returns the JSON shape of icestats.source in a status body
+func sourceShape(body []byte) string {
+	var root struct {
+		Icestats map[string]json.RawMessage `json:"icestats"`
+	}
+	if err := json.Unmarshal(body, &root); err != nil || root.Icestats == nil {
+		return "missing"
+	}
+	source, ok := root.Icestats["source"]
+	if !ok {
+		return "missing"
+	}
+	source = bytes.TrimSpace(source)
+	switch {
+	case len(source) == 0:
+		return "missing"
+	case source[0] == '[':
+		return "array"
+	case source[0] == '{':
+		return "object"
+	case bytes.Equal(source, []byte("null")):
+		return "null"
+	case source[0] == '"':
+		return "string"
+	}
+	return "other"
+}
+
+// sourceEntries returns the number of entries of an icestats.source array
+func sourceEntries(body []byte) int {
+	var root struct {
+		Icestats struct {
+			Source []json.RawMessage `json:"source"`
+		} `json:"icestats"`
+	}
+	if err := json.Unmarshal(body, &root); err != nil {
+		return 0
+	}
+	return len(root.Icestats.Source)
+}
+
+// diagnose parses the body like a poll does and explains the result
+func diagnose(p *poller, body []byte, opts collector.Options) (*debugDiagnostics, []debugStream) {
+	fixed := []byte(icecast.FixBlankTitle(body))
+	d := &debugDiagnostics{
+		Source:        sourceShape(fixed),
+		BlankTitleFix: !bytes.Equal(fixed, body),
+	}
+	status, err := icecast.ParseStatus(body)
+	if err != nil {
+		d.ParseError = err.Error()
+		return d, nil
+	}
+	switch d.Source {
+	case "array":
+		d.Entries = sourceEntries(fixed)
+	case "object":
+		d.Entries = 1
+	}
+	d.SkippedEntries = d.Entries - len(status.Icestats.Source)
+
+	kept := map[string]bool{}
+	for _, s := range collector.Streams(p.url, p.serverName, status) {
+		kept[s.ListenURL] = true
+	}
+	var streams []debugStream
+	for _, s := range collector.Streams(p.url, "", status) {
+		ds := debugStream{ListenURL: s.ListenURL, ServerName: s.ServerName, Listeners: s.Listeners, Filtered: !kept[s.ListenURL]}
+		if !ds.Filtered {
+			ds.StreamURL = opts.StreamURLFormat.Label(s)
+			if opts.LegacyLabels {
+				ds.ServerName = collector.LegacyLabel(ds.ServerName)
+				ds.StreamURL = collector.LegacyLabel(ds.StreamURL)
+			}
+		}
+		streams = append(streams, ds)
+	}
+	return d, streams
+}
+
+// lastScrapeHandler serves the raw body of the last status response of the
+// target given by the target parameter together with parse diagnostics
+func lastScrapeHandler(targets *targetManager, opts collector.Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		target := r.URL.Query().Get("target")
+		var p *poller
+		var known []string
+		for _, candidate := range targets.pollers() {
+			// the listed URLs have their password masked, an exact match wins
+			if candidate.url == target || (p == nil && redactURL(candidate.url) == target) {
+				p = candidate
+			}
+			known = append(known, redactURL(candidate.url))
+		}
+		if p == nil {
+			http.Error(w, fmt.Sprintf("unknown target %q, known targets:\n%s", target, strings.Join(known, "\n")), http.StatusNotFound)
+			return
+		}
+
+		result, _ := p.result.Load().(pollResult)
+		last := debugLastScrape{
+			Target:    redactURL(p.url),
+			LastPoll:  timeOrNil(result.at),
+			LastError: strings.ReplaceAll(result.err, p.url, redactURL(p.url)),
+		}
+		if resp, ok := p.lastResponse.Load().(icecast.Response); ok {
+			last.Response = &debugResponse{
+				URL:         redactURL(resp.URL),
+				Status:      resp.Status,
+				ContentType: resp.ContentType,
+				ReceivedAt:  resp.ReceivedAt,
+				Body:        string(resp.Body),
+			}
+			// error pages are not parsed
+			if resp.StatusCode == http.StatusOK {
+				last.Diagnostics, last.Streams = diagnose(p, resp.Body, opts)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(last); err != nil {
+			log.Println("Error writing last scrape:", err)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// legacyFlags maps the flags of the standard flag package used before the
+// move to kingpin to their new names
+var legacyFlags = map[string]string{
+	"url":          "icecast.url",
+	"port":         "web.listen-address",
+	"endpoint":     "web.telemetry-path",
+	"interval":     "icecast.interval",
+	"clock":        "vclock.address",
+	"filter":       "icecast.filter",
+	"legacy-label": "icecast.legacy-label",
+}
+
+// rewriteLegacyFlags replaces the deprecated flags in args with their new
+// names, so existing unit files and rc.d scripts keep working. They were
+// accepted with a single dash, which kingpin reads as short flags
+func rewriteLegacyFlags(args []string) []string {
+	rewritten := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(rewritten, args[i:]...)
+		}
+		if !strings.HasPrefix(arg, "-") {
+			rewritten = append(rewritten, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		newName, ok := legacyFlags[name]
+		if !ok {
+			rewritten = append(rewritten, arg)
+			continue
+		}
+		log.Printf("Flag -%s is deprecated, use --%s instead", name, newName)
+
+		if name == "legacy-label" {
+			// the flag package accepted -legacy-label=false
+			if !hasValue || value == "true" {
+				rewritten = append(rewritten, "--"+newName)
+			}
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				// kingpin reports the missing value
+				rewritten = append(rewritten, "--"+newName)
+				continue
+			}
+			i++
+			value = args[i]
+		}
+		if name == "port" {
+			value = ":" + value
+		}
+		rewritten = append(rewritten, "--"+newName+"="+value)
+	}
+	return rewritten
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRewriteLegacyFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"none", nil, []string{}},
+		{
+			"new flags untouched",
+			[]string{"--icecast.url", "http://localhost:8000/status-json.xsl", "--web.listen-address=:2112"},
+			[]string{"--icecast.url", "http://localhost:8000/status-json.xsl", "--web.listen-address=:2112"},
+		},
+		{
+			"single dash with values",
+			[]string{"-url", "http://localhost:8000/status-json.xsl", "-port", "1234", "-filter", "Example Radio", "-interval", "20"},
+			[]string{"--icecast.url=http://localhost:8000/status-json.xsl", "--web.listen-address=:1234", "--icecast.filter=Example Radio", "--icecast.interval=20"},
+		},
+		{
+			"inline values",
+			[]string{"-endpoint=/m", "--clock=vclock:1234"},
+			[]string{"--web.telemetry-path=/m", "--vclock.address=vclock:1234"},
+		},
+		{
+			"boolean",
+			[]string{"-legacy-label", "-legacy-label=true", "-legacy-label=false"},
+			[]string{"--icecast.legacy-label", "--icecast.legacy-label"},
+		},
+		{"missing value", []string{"-url"}, []string{"--icecast.url"}},
+		{
+			"commands and terminator",
+			[]string{"scrape", "-url", "http://a", "--", "-port"},
+			[]string{"scrape", "--icecast.url=http://a", "--", "-port"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteLegacyFlags(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rewriteLegacyFlags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
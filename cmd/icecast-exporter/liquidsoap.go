@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	liquidsoapUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "icecast_liquidsoap_up",
+		Help: "Whether the Liquidsoap telnet interface could be reached",
+	})
+	encoderUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "icecast_encoder_up",
+		Help: "Whether the Liquidsoap output is started (1) or stopped/unreachable (0)",
+	}, []string{"output"})
+	encoderSource = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "icecast_encoder_source_selected",
+		Help: "Source currently selected for the Liquidsoap output",
+	}, []string{"output", "source"})
+	encoderBuffer = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "icecast_encoder_buffer_seconds",
+		Help: "Buffered audio of the Liquidsoap output in seconds",
+	}, []string{"output"})
+)
+
+const liquidsoapTimeout = 5 * time.Second
+
+type liquidsoapClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialLiquidsoap(addr string) (*liquidsoapClient, error) {
+	conn, err := net.DialTimeout("tcp", addr, liquidsoapTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &liquidsoapClient{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// command sends a single telnet command and returns the reply without the
+// terminating END line
+func (c *liquidsoapClient) command(cmd string) (string, error) {
+	c.conn.SetDeadline(time.Now().Add(liquidsoapTimeout))
+
+	if _, err := fmt.Fprintf(c.conn, "%s\n", cmd); err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "END" {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	reply := strings.TrimSpace(strings.Join(lines, "\n"))
+	if strings.HasPrefix(reply, "ERROR") {
+		return "", fmt.Errorf("liquidsoap: %s", reply)
+	}
+	return reply, nil
+}
+
+func (c *liquidsoapClient) Close() error {
+	fmt.Fprint(c.conn, "quit\n")
+	return c.conn.Close()
+}
+
+type liquidsoapPoller struct {
+	addr    string
+	outputs []string
+	// last selected source per output, used to drop the previous series
+	selected map[string]string
+	// last errors of the connection and per output, only changes are logged
+	lastErr       string
+	lastOutputErr map[string]string
+}
+
+func (p *liquidsoapPoller) setSelected(output string, source string) {
+	if prev, ok := p.selected[output]; ok && prev != source {
+		encoderSource.DeleteLabelValues(output, prev)
+	}
+	if source == "" {
+		delete(p.selected, output)
+		return
+	}
+	p.selected[output] = source
+	encoderSource.WithLabelValues(output, source).Set(1)
+}
+
+func (p *liquidsoapPoller) markDown() {
+	liquidsoapUp.Set(0)
+	for _, o := range p.outputs {
+		encoderUp.WithLabelValues(o).Set(0)
+		encoderBuffer.DeleteLabelValues(o)
+		p.setSelected(o, "")
+	}
+}
+
+func (p *liquidsoapPoller) poll() error {
+	client, err := dialLiquidsoap(p.addr)
+	if err != nil {
+		if err.Error() != p.lastErr {
+			log.Println("Error connecting to Liquidsoap:", err)
+		}
+		p.lastErr = err.Error()
+		p.markDown()
+		return err
+	}
+	defer client.Close()
+
+	if p.lastErr != "" {
+		log.Println("Liquidsoap at", p.addr, "is reachable again")
+		p.lastErr = ""
+	}
+	liquidsoapUp.Set(1)
+
+	for _, o := range p.outputs {
+		status, err := client.command(o + ".status")
+		if err != nil {
+			if err.Error() != p.lastOutputErr[o] {
+				log.Printf("Error querying status of Liquidsoap output %s: %v", o, err)
+			}
+			p.lastOutputErr[o] = err.Error()
+			encoderUp.WithLabelValues(o).Set(0)
+			continue
+		}
+		delete(p.lastOutputErr, o)
+		if status == "on" {
+			encoderUp.WithLabelValues(o).Set(1)
+		} else {
+			encoderUp.WithLabelValues(o).Set(0)
+		}
+
+		// source and buffer are optional commands registered by the script,
+		// see README for an example
+		if source, err := client.command(o + ".source"); err == nil {
+			p.setSelected(o, source)
+		}
+		if reply, err := client.command(o + ".buffer"); err == nil {
+			if buffer, err := strconv.ParseFloat(reply, 64); err == nil {
+				encoderBuffer.WithLabelValues(o).Set(buffer)
+			}
+		}
+	}
+	return nil
+}
+
+func newLiquidsoapPoller(addr string, outputs []string) *liquidsoapPoller {
+	reg.MustRegister(liquidsoapUp, encoderUp, encoderSource, encoderBuffer)
+
+	return &liquidsoapPoller{addr: addr, outputs: outputs, selected: map[string]string{}, lastOutputErr: map[string]string{}}
+}
+
+func updateLiquidsoap(p *liquidsoapPoller, wait int) {
+	go func() {
+		for {
+			p.poll()
+			time.Sleep(time.Duration(wait) * time.Second)
+		}
+	}()
+}
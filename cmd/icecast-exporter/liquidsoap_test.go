@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeLiquidsoap answers telnet commands with the given replies, unknown
+// commands get an error like Liquidsoap's
+func fakeLiquidsoap(t *testing.T, replies map[string]string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					cmd := strings.TrimSpace(scanner.Text())
+					if cmd == "quit" {
+						return
+					}
+					reply, ok := replies[cmd]
+					if !ok {
+						reply = "ERROR: unknown command, type \"help\" to get a list of commands."
+					}
+					conn.Write([]byte(reply + "\r\nEND\r\n"))
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestLiquidsoapCommand(t *testing.T) {
+	addr := fakeLiquidsoap(t, map[string]string{
+		"mp3.status": "on",
+		"mp3.source": "  live  ",
+		"multi":      "line 1\r\nline 2",
+		"empty":      "",
+	})
+	client, err := dialLiquidsoap(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		cmd     string
+		want    string
+		wantErr bool
+	}{
+		{"mp3.status", "on", false},
+		{"mp3.source", "live", false},
+		{"multi", "line 1\nline 2", false},
+		{"empty", "", false},
+		{"mp3.buffer", "", true},
+		// the connection is still usable after an error
+		{"mp3.status", "on", false},
+	}
+	for _, tt := range tests {
+		got, err := client.command(tt.cmd)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("command(%q) error = %v, want error %v", tt.cmd, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("command(%q) = %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestLiquidsoapPoll(t *testing.T) {
+	addr := fakeLiquidsoap(t, map[string]string{
+		"mp3.status": "on",
+		"mp3.source": "live",
+		"mp3.buffer": "2.5",
+		"ogg.status": "off",
+	})
+	p := &liquidsoapPoller{addr: addr, outputs: []string{"mp3", "ogg"}, selected: map[string]string{}, lastOutputErr: map[string]string{}}
+	if err := p.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(liquidsoapUp); got != 1 {
+		t.Errorf("icecast_liquidsoap_up = %v, want 1", got)
+	}
+	for output, want := range map[string]float64{"mp3": 1, "ogg": 0} {
+		if got := testutil.ToFloat64(encoderUp.WithLabelValues(output)); got != want {
+			t.Errorf("icecast_encoder_up{output=%q} = %v, want %v", output, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(encoderBuffer.WithLabelValues("mp3")); got != 2.5 {
+		t.Errorf("icecast_encoder_buffer_seconds = %v, want 2.5", got)
+	}
+	if got := testutil.ToFloat64(encoderSource.WithLabelValues("mp3", "live")); got != 1 {
+		t.Errorf("icecast_encoder_source_selected = %v, want 1", got)
+	}
+
+	// an unreachable Liquidsoap marks all outputs down
+	p.addr = "127.0.0.1:1"
+	if err := p.poll(); err == nil {
+		t.Fatal("poll() of an unreachable Liquidsoap returned no error")
+	}
+	if got := testutil.ToFloat64(liquidsoapUp); got != 0 {
+		t.Errorf("icecast_liquidsoap_up = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(encoderUp.WithLabelValues("mp3")); got != 0 {
+		t.Errorf("icecast_encoder_up{output=\"mp3\"} = %v, want 0", got)
+	}
+	if p.lastErr == "" {
+		t.Error("the connection error was not kept to log only changes")
+	}
+}
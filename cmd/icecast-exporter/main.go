@@ -0,0 +1,622 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+var (
+	reg          = prometheus.NewRegistry()
+	scrapeErrors = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "icecast_scrape_errors_total",
+		Help: "Total number of failed polls of the Icecast status endpoint",
+	}, []string{"target"})
+	pollBackoff = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "icecast_poll_backoff_seconds",
+		Help: "Current delay before retrying a failing Icecast endpoint, 0 if the last poll succeeded",
+	}, []string{"target"})
+	scrapeDuration = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "icecast_scrape_duration_seconds",
+		Help: "Duration of the last poll of the Icecast status endpoint",
+	}, []string{"target"})
+)
+
+// scrapeOnce polls every target a single time and writes the metrics in text
+// exposition format to stdout, it returns the exit code of the process
+func scrapeOnce(pollers []*poller, lsPoller *liquidsoapPoller) int {
+	failed := pollAll(pollers)
+	if lsPoller != nil && lsPoller.poll() != nil {
+		failed++
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		log.Println("Error gathering metrics:", err)
+		return 1
+	}
+
+	encoder := expfmt.NewEncoder(os.Stdout, expfmt.FmtText)
+	for _, mf := range families {
+		if err := encoder.Encode(mf); err != nil {
+			log.Println("Error writing metrics:", err)
+			return 1
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	// started by the Windows service manager
+	if runService() {
+		return
+	}
+	run()
+}
+
+// run parses the command line and runs the command, serving the metrics
+// until the process is stopped
+func run() {
+	app := kingpin.New("icecast-exporter", "Exports statistics from Icecast into Prometheus.")
+	app.HelpFlag.Short('h')
+	app.Command("serve", "poll the targets and serve the metrics, the default command").Default()
+	scrapeCmd := app.Command("scrape", "poll all targets once, print the metrics to stdout and exit")
+	checkCmd := app.Command("check-config", "check the config file and exit")
+	probePtr := checkCmd.Flag("probe", "poll every target once and report whether it is reachable").Bool()
+	versionCmd := app.Command("version", "print the version and exit")
+	serviceCommand := serviceCommands(app)
+
+	urlPtr := app.Flag("icecast.url", "Icecast status endpoint (normally: http://icecast.example.com/status-json.xsl)").String()
+	configPtr := app.Flag("config.file", "YAML config file with a list of Icecast targets, publishers, VClocks, alerts and notifiers").String()
+	targetsFilePtr := app.Flag("targets.file", "JSON or YAML file with Icecast targets in the Prometheus file_sd format, reloaded on changes").String()
+	dnsSDNamePtr := app.Flag("dns-sd.name", "DNS SRV name of the Icecast backends (_icecast._tcp.example.com), enables DNS discovery").String()
+	dnsSDIntervalPtr := app.Flag("dns-sd.interval", "Interval in seconds to resolve the DNS SRV name").Default("30").Int()
+	dnsSDSchemePtr := app.Flag("dns-sd.scheme", "scheme used to poll the discovered Icecast backends, http or https").Default("http").String()
+	consulAddressPtr := app.Flag("consul.address", "Consul HTTP API address").Default("http://localhost:8500").String()
+	consulServicePtr := app.Flag("consul.service", "Consul service of the Icecast instances, enables Consul discovery").String()
+	consulTagPtr := app.Flag("consul.tag", "only discover Consul instances with this tag").String()
+	consulTokenPtr := app.Flag("consul.token", "Consul ACL token").String()
+	consulSchemePtr := app.Flag("consul.scheme", "scheme used to poll the discovered Icecast instances, http or https").Default("http").String()
+	kubeSelectorPtr := app.Flag("kubernetes.selector", "label selector of the Icecast pods or services (app=icecast), enables Kubernetes discovery").String()
+	kubeRolePtr := app.Flag("kubernetes.role", "discover Kubernetes pods or services: pod or service").Default("pod").String()
+	kubeNamespacePtr := app.Flag("kubernetes.namespace", "Kubernetes namespace to discover in, all namespaces if empty").String()
+	kubePortPtr := app.Flag("kubernetes.port", "Icecast port of the discovered pods or services").Default("8000").Int()
+	kubeconfigPtr := app.Flag("kubernetes.kubeconfig", "kubeconfig used outside of the cluster, the in-cluster config is used if empty").String()
+	kubeIntervalPtr := app.Flag("kubernetes.interval", "Interval in seconds to list the Kubernetes pods or services").Default("30").Int()
+	dockerSocketPtr := app.Flag("docker.socket", "unix socket of the Docker API (/var/run/docker.sock), enables discovery of labeled containers").String()
+	listenAddressPtr := app.Flag("web.listen-address", "Address to listen on for metrics, empty disables the HTTP server").Default(":2112").String()
+	telemetryPathPtr := app.Flag("web.telemetry-path", "Path under which to expose the metrics").Default("/metrics").String()
+	corsOriginPtr := app.Flag("web.cors-origin", "Access-Control-Allow-Origin sent with the JSON API, e.g. * or https://radio.example.com").String()
+	openMetricsPtr := app.Flag("web.enable-openmetrics", "serve the OpenMetrics format with _created samples of the counters to clients asking for it").Bool()
+	app.Flag("web.disable-exporter-metrics", "accepted for compatibility with other exporters, the go_* and process_* metrics it excludes are never exported").Bool()
+	disableHealthMetricsPtr := app.Flag("web.disable-health-metrics", "exclude icecast_scrape_errors_total, icecast_scrape_duration_seconds, icecast_poll_backoff_seconds, icecast_discovered_targets and icecast_vclock_publish_errors_total").Bool()
+	debugStatePtr := app.Flag("web.enable-debug-state", "serve the state of the targets and publishers at /debug/state and the last status responses at /debug/last-scrape as JSON").Bool()
+	timestampsPtr := app.Flag("web.sample-timestamps", "export the listener samples with the time of the poll as timestamp instead of the time of the scrape").Bool()
+	waitPtr := app.Flag("icecast.interval", "Interval to update statistics from Icecast").Default("15").Int()
+	concurrencyPtr := app.Flag("icecast.concurrency", "Maximum number of Icecast targets polled at the same time").Default("4").Int()
+	timeoutPtr := app.Flag("icecast.timeout", "Timeout in seconds for a single poll of an Icecast target").Default("10").Int()
+	usernamePtr := app.Flag("icecast.username", "username for basic auth against the Icecast targets").String()
+	passwordPtr := app.Flag("icecast.password", "password for basic auth against the Icecast targets").String()
+	adminUsernamePtr := app.Flag("icecast.admin-username", "Icecast admin username for the listener churn counters").Default("admin").String()
+	adminPasswordPtr := app.Flag("icecast.admin-password", "Icecast admin password, enables the listener churn counters").String()
+	authSuccessStatPtr := app.Flag("icecast.auth-success-stat", "admin stat of a mount counting the listeners accepted by its listener authentication").String()
+	authFailuresStatPtr := app.Flag("icecast.auth-failures-stat", "admin stat of a mount counting the listeners rejected by its listener authentication").String()
+	unixSocketPtr := app.Flag("icecast.unix-socket", "unix socket to connect to instead of the host of the Icecast URL, which is still sent as Host header").String()
+	idleTimeoutPtr := app.Flag("icecast.idle-timeout", "Time in seconds idle connections to the Icecast targets are kept open for the next poll").Default("120").Int()
+	http2Ptr := app.Flag("icecast.http2", "negotiate HTTP/2 with TLS targets, --no-icecast.http2 disables it").Default("true").Bool()
+	listenerIPPtr := app.Flag("privacy.listener-ip", "what to do with the listener IPs of the admin client lists before any processing: keep, truncate, hash or drop").Default("keep").String()
+	caFilePtr := app.Flag("icecast.tls.ca-file", "CA certificate file to verify the Icecast targets").String()
+	certFilePtr := app.Flag("icecast.tls.cert-file", "client certificate file for the Icecast targets").String()
+	keyFilePtr := app.Flag("icecast.tls.key-file", "client key file for the Icecast targets").String()
+	tlsServerNamePtr := app.Flag("icecast.tls.server-name", "server name to verify the certificates of the Icecast targets against").String()
+	insecurePtr := app.Flag("icecast.tls.insecure-skip-verify", "do not verify the certificates of the Icecast targets").Bool()
+	peakWindowsPtr := app.Flag("peak.windows", "comma separated windows of the peak listeners (24h,7d), empty disables them").Default("24h").String()
+	peakStateFilePtr := app.Flag("peak.state-file", "file to keep the peak listeners in across restarts").String()
+	availabilityWindowsPtr := app.Flag("availability.windows", "comma separated windows of the stream availability (30d), empty disables it").Default("30d").String()
+	availabilityStateFilePtr := app.Flag("availability.state-file", "file to keep the stream availability in across restarts").String()
+	textfilePtr := app.Flag("textfile.path", "periodically write the metrics to this .prom file for the node_exporter textfile collector").String()
+	textfileIntervalPtr := app.Flag("textfile.interval", "Interval in seconds to write the textfile, defaults to --icecast.interval").Int()
+	pushURLPtr := app.Flag("push.gateway-url", "Pushgateway URL, enables pushing the metrics").String()
+	pushIntervalPtr := app.Flag("push.interval", "Interval in seconds to push the metrics, defaults to --icecast.interval").Int()
+	pushJobPtr := app.Flag("push.job", "job label used for pushing").Default("icecast").String()
+	pushGroupingPtr := app.Flag("push.grouping", "additional grouping labels used for pushing (instance=relay1,site=berlin)").String()
+	pushUsernamePtr := app.Flag("push.username", "username for basic auth against the Pushgateway").String()
+	pushPasswordPtr := app.Flag("push.password", "password for basic auth against the Pushgateway").String()
+	remoteWriteURLPtr := app.Flag("remote-write.url", "Prometheus remote_write URL, enables sending the metrics").String()
+	remoteWriteIntervalPtr := app.Flag("remote-write.interval", "Interval in seconds to send the metrics, defaults to --icecast.interval").Int()
+	remoteWriteLabelsPtr := app.Flag("remote-write.external-labels", "labels added to all remote written series (instance=relay1,site=berlin)").String()
+	remoteWriteTokenPtr := app.Flag("remote-write.bearer-token", "bearer token for the remote_write endpoint").String()
+	remoteWriteUsernamePtr := app.Flag("remote-write.username", "username for basic auth against the remote_write endpoint").String()
+	remoteWritePasswordPtr := app.Flag("remote-write.password", "password for basic auth against the remote_write endpoint").String()
+	otlpEndpointPtr := app.Flag("otlp.endpoint", "OTLP/HTTP endpoint (http://collector:4318), enables exporting the metrics via OTLP, gRPC is not supported").String()
+	otlpIntervalPtr := app.Flag("otlp.interval", "Interval in seconds to export the metrics via OTLP, defaults to --icecast.interval").Int()
+	otlpHeadersPtr := app.Flag("otlp.headers", "HTTP headers sent with OTLP requests (Authorization=Bearer secret)").String()
+	otlpAttributesPtr := app.Flag("otlp.resource-attributes", "OTLP resource attributes (service.instance.id=relay1,host.name=icecast1)").String()
+	statsdAddressPtr := app.Flag("statsd.address", "StatsD address (host:port), enables sending the metrics as StatsD gauges").String()
+	statsdIntervalPtr := app.Flag("statsd.interval", "Interval in seconds to send the metrics to StatsD, defaults to --icecast.interval").Int()
+	statsdPrefixPtr := app.Flag("statsd.prefix", "prefix of the StatsD metric names").Default("icecast").String()
+	statsdDogPtr := app.Flag("statsd.dogstatsd", "send labels as DogStatsD tags instead of adding them to the metric name").Bool()
+	graphiteAddressPtr := app.Flag("graphite.address", "Graphite carbon plaintext address (host:port), enables sending the metrics to Graphite").String()
+	graphiteIntervalPtr := app.Flag("graphite.interval", "Interval in seconds to send the metrics to Graphite, defaults to --icecast.interval").Int()
+	graphitePrefixPtr := app.Flag("graphite.prefix", "prefix of the Graphite metric paths").Default("icecast").String()
+	influxURLPtr := app.Flag("influxdb.url", "InfluxDB URL (http://influxdb:8086), enables writing the metrics to InfluxDB").String()
+	influxVersionPtr := app.Flag("influxdb.version", "InfluxDB write API version, 1 or 2").Default("2").Int()
+	influxIntervalPtr := app.Flag("influxdb.interval", "Interval in seconds to write the metrics to InfluxDB, defaults to --icecast.interval").Int()
+	influxDatabasePtr := app.Flag("influxdb.database", "InfluxDB database (version 1)").String()
+	influxUsernamePtr := app.Flag("influxdb.username", "InfluxDB username (version 1)").String()
+	influxPasswordPtr := app.Flag("influxdb.password", "InfluxDB password (version 1)").String()
+	influxTokenPtr := app.Flag("influxdb.token", "InfluxDB API token (version 2)").String()
+	influxOrgPtr := app.Flag("influxdb.org", "InfluxDB organization (version 2)").String()
+	influxBucketPtr := app.Flag("influxdb.bucket", "InfluxDB bucket (version 2)").String()
+	mqttBrokerPtr := app.Flag("mqtt.broker", "MQTT broker URL (tcp://mqtt.example.com:1883), enables publishing listeners via MQTT").String()
+	mqttClientIDPtr := app.Flag("mqtt.client-id", "MQTT client id").Default("icecast-exporter").String()
+	mqttUsernamePtr := app.Flag("mqtt.username", "MQTT username").String()
+	mqttPasswordPtr := app.Flag("mqtt.password", "MQTT password").String()
+	mqttTopicPtr := app.Flag("mqtt.topic", "template of the MQTT topic for the listeners of a stream").Default("icecast/{{.Mount}}/listeners").String()
+	mqttStateTopicPtr := app.Flag("mqtt.state-topic", "template of the MQTT topic for up/down events of a stream, empty disables the events").Default("icecast/{{.Mount}}/state").String()
+	mqttQoSPtr := app.Flag("mqtt.qos", "MQTT QoS level of published messages").Int()
+	mqttRetainPtr := app.Flag("mqtt.retain", "publish MQTT messages with the retain flag").Bool()
+	onDemandPtr := app.Flag("icecast.on-demand", "poll Icecast when metrics are requested instead of in the background").Bool()
+	cacheMaxAgePtr := app.Flag("icecast.cache-max-age", "Time in seconds an on-demand poll result is reused for further metric requests").Default("10").Int()
+	maxBackoffPtr := app.Flag("icecast.backoff-max", "Maximum delay in seconds between polls of a failing Icecast endpoint").Default("300").Int()
+	clockPtr := app.Flag("vclock.address", "VClock address, enables publishing the listeners to the VClock").String()
+	clockTimeoutPtr := app.Flag("vclock.timeout", "Timeout in seconds for a single publish to a VClock").Default("5").Int()
+	clockRetriesPtr := app.Flag("vclock.retries", "Number of retries of a failed publish to a VClock").Default("2").Int()
+	clockMinIntervalPtr := app.Flag("vclock.min-interval", "Minimum time in seconds between two publishes to a VClock").Int()
+	clockAggregatePtr := app.Flag("vclock.aggregate", "listeners shown on the VClock: sum or max over all collected streams, or stream for the stream selected by --vclock.stream").Default("sum").String()
+	clockStreamPtr := app.Flag("vclock.stream", "mount (e.g. live.mp3) of the stream shown on the VClock with --vclock.aggregate stream").String()
+	serverNamePtr := app.Flag("icecast.filter", "filter for server_name, only streams with this server_name will be collected").String()
+	streamURLFormatPtr := app.Flag("label.stream-url-format", "how the stream_url label of icecast_listeners is rendered: mount, path, host-and-mount or full-url").Default("mount").String()
+	legacyLabelPtr := app.Flag("icecast.legacy-label", "make label names compatible with prometheus < 3.0 (space and dot will be replaced by underscore)").Bool()
+	liquidsoapPtr := app.Flag("liquidsoap.address", "Liquidsoap telnet address (host:port), enables encoder metrics").String()
+	liquidsoapOutputsPtr := app.Flag("liquidsoap.outputs", "comma separated list of Liquidsoap output ids to monitor").String()
+
+	command := kingpin.MustParse(app.Parse(rewriteLegacyFlags(os.Args[1:])))
+	once := command == scrapeCmd.FullCommand()
+
+	if command == versionCmd.FullCommand() {
+		fmt.Println("icecast-exporter", buildVersion())
+		return
+	}
+	if serviceCommand(command) {
+		return
+	}
+
+	config := new(Config)
+	if *configPtr != "" {
+		var err error
+		if config, err = loadConfig(*configPtr); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *urlPtr != "" {
+		config.Targets = append(config.Targets, TargetConfig{URL: *urlPtr})
+	}
+
+	// target options not set in the config file
+	defaults := TargetConfig{
+		Filter:        *serverNamePtr,
+		Interval:      time.Duration(*waitPtr) * time.Second,
+		Timeout:       time.Duration(*timeoutPtr) * time.Second,
+		Username:      *usernamePtr,
+		Password:      *passwordPtr,
+		UnixSocket:    *unixSocketPtr,
+		AdminUsername: *adminUsernamePtr,
+		AdminPassword: *adminPasswordPtr,
+		AuthStats:     AuthStatsConfig{Success: *authSuccessStatPtr, Failures: *authFailuresStatPtr},
+		TLS: TLSConfig{
+			CAFile:     *caFilePtr,
+			CertFile:   *certFilePtr,
+			KeyFile:    *keyFilePtr,
+			ServerName: *tlsServerNamePtr,
+		},
+	}
+	if *insecurePtr {
+		defaults.TLS.InsecureSkipVerify = insecurePtr
+	}
+
+	transports := newTransportPool(time.Duration(*idleTimeoutPtr)*time.Second, *http2Ptr)
+
+	if command == checkCmd.FullCommand() {
+		os.Exit(checkConfig(config, defaults, transports, *targetsFilePtr, *probePtr))
+	}
+
+	if len(config.Targets) == 0 && *targetsFilePtr == "" && *dnsSDNamePtr == "" && *consulServicePtr == "" && *kubeSelectorPtr == "" && *dockerSocketPtr == "" {
+		log.Fatalf("Missing required argument --icecast.url, --targets.file, --dns-sd.name, --consul.service, --kubernetes.selector, --docker.socket or targets in --config.file, see '%s --help' for information", os.Args[0])
+	}
+
+	log.Println("Starting Icecast Exporter")
+	started := time.Now()
+
+	if *serverNamePtr != "" {
+		log.Println("filter for ", *serverNamePtr)
+	}
+
+	if *legacyLabelPtr {
+		log.Println("use legacy label names")
+	}
+
+	// leaves out the health of the polls, discoveries and VClock publishes
+	if *disableHealthMetricsPtr {
+		reg.Unregister(scrapeErrors)
+		reg.Unregister(pollBackoff)
+		reg.Unregister(scrapeDuration)
+		reg.Unregister(discoveredTargets)
+		reg.Unregister(vclockErrors)
+	}
+
+	interval := time.Duration(*waitPtr) * time.Second
+	if *concurrencyPtr < 1 {
+		log.Fatalf("Invalid --icecast.concurrency %d, must be at least 1", *concurrencyPtr)
+	}
+	slots := make(chan struct{}, *concurrencyPtr)
+	var publishers []streamPublisher
+	var targets *targetManager
+	if *mqttBrokerPtr != "" {
+		if *mqttQoSPtr < 0 || *mqttQoSPtr > 2 {
+			log.Fatalf("Invalid --mqtt.qos %d, must be 0, 1 or 2", *mqttQoSPtr)
+		}
+		pub, err := newMQTTPublisher(mqttOptions{
+			broker:         *mqttBrokerPtr,
+			clientID:       *mqttClientIDPtr,
+			username:       *mqttUsernamePtr,
+			password:       *mqttPasswordPtr,
+			listenersTopic: *mqttTopicPtr,
+			stateTopic:     *mqttStateTopicPtr,
+			qos:            byte(*mqttQoSPtr),
+			retain:         *mqttRetainPtr,
+		})
+		if err != nil {
+			log.Fatalf("Invalid MQTT topic: %v", err)
+		}
+		log.Println("publish listeners to MQTT broker", *mqttBrokerPtr)
+		publishers = append(publishers, pub)
+	}
+
+	if *clockPtr != "" {
+		config.Clocks = append(config.Clocks, ClockConfig{
+			Address:   *clockPtr,
+			Aggregate: *clockAggregatePtr,
+			Mount:     *clockStreamPtr,
+		})
+	}
+	for i, c := range config.Clocks {
+		pub, err := newVClockPublisher(c, vclockOptions{
+			timeout:     time.Duration(*clockTimeoutPtr) * time.Second,
+			retries:     *clockRetriesPtr,
+			minInterval: time.Duration(*clockMinIntervalPtr) * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("Invalid VClock %d: %v", i+1, err)
+		}
+		log.Println("publish listeners to VClock", c.Address)
+		publishers = append(publishers, pub)
+	}
+
+	for i, c := range config.Publishers {
+		pub, err := newWebhookPublisher(c)
+		if err != nil {
+			log.Fatalf("Invalid publisher %d: %v", i+1, err)
+		}
+		publishers = append(publishers, pub)
+	}
+
+	if len(config.Alerts) > 0 {
+		pub, err := newAlertPublisher(config.Alerts)
+		if err != nil {
+			log.Fatalf("Invalid alerts: %v", err)
+		}
+		log.Println("evaluate", len(config.Alerts), "alerts")
+		publishers = append(publishers, pub)
+	}
+
+	if len(config.Profiles) > 0 {
+		pub, err := newProfileChecker(config.Profiles, *legacyLabelPtr)
+		if err != nil {
+			log.Fatalf("Invalid profiles: %v", err)
+		}
+		log.Println("check", len(config.Profiles), "stream profiles")
+		publishers = append(publishers, pub)
+	}
+
+	if len(config.ExpectedMounts) > 0 {
+		var notifiers []*notifier
+		for i, c := range config.Notifiers {
+			n, err := newNotifier(c)
+			if err != nil {
+				log.Fatalf("Invalid notifier %d: %v", i+1, err)
+			}
+			notifiers = append(notifiers, n)
+		}
+		log.Println("track expected mounts", strings.Join(config.ExpectedMounts, ", "))
+		publishers = append(publishers, newExpectedMounts(config.ExpectedMounts, notifiers, func() int { return len(targets.pollers()) }, 2*interval))
+	} else if len(config.Notifiers) > 0 {
+		log.Fatal("Notifiers need expected_mounts in the config file")
+	}
+
+	peakWindows, err := parseRollingWindows(*peakWindowsPtr)
+	if err != nil {
+		log.Fatalf("Invalid --peak.windows: %v", err)
+	}
+	if len(peakWindows) > 0 {
+		peaks := newPeakTracker(peakWindows, *peakStateFilePtr, *legacyLabelPtr)
+		if *peakStateFilePtr != "" && !once {
+			saveState("peak listeners", peaks.save, time.Minute)
+		}
+		publishers = append(publishers, peaks)
+	}
+
+	availabilityWindows, err := parseRollingWindows(*availabilityWindowsPtr)
+	if err != nil {
+		log.Fatalf("Invalid --availability.windows: %v", err)
+	}
+	if len(availabilityWindows) > 0 {
+		availability := newAvailabilityTracker(availabilityWindows, *availabilityStateFilePtr, *legacyLabelPtr)
+		if *availabilityStateFilePtr != "" && !once {
+			saveState("availability", availability.save, time.Minute)
+		}
+		publishers = append(publishers, availability)
+	}
+
+	streamURLFormat, err := collector.ParseStreamURLFormat(*streamURLFormatPtr)
+	if err != nil {
+		log.Fatalf("Invalid --label.stream-url-format: %v", err)
+	}
+
+	listenerIP, err := listenerIPFunc(*listenerIPPtr)
+	if err != nil {
+		log.Fatalf("Invalid --privacy.listener-ip: %v", err)
+	}
+
+	// pollers are started by the target manager, in the background unless
+	// polling on demand or once
+	targets = newTargetManager(poller{
+		slots:        slots,
+		publishers:   publishers,
+		keepResponse: *debugStatePtr,
+	}, defaults, transports, listenerIP, *legacyLabelPtr, time.Duration(*maxBackoffPtr)*time.Second, !*onDemandPtr && !once)
+	listenerOpts := collector.Options{LegacyLabels: *legacyLabelPtr, StreamURLFormat: streamURLFormat, Timestamps: *timestampsPtr}
+	reg.MustRegister(collector.NewListenerCollector(targets.streams, listenerOpts))
+	if len(config.Clusters) > 0 {
+		log.Println("aggregate", len(config.Clusters), "clusters")
+		reg.MustRegister(&clusterCollector{pollers: targets.pollers, legacyLabel: *legacyLabelPtr, timestamps: *timestampsPtr})
+	}
+	targets.sync("config", config.Targets)
+	if *targetsFilePtr != "" {
+		if err := watchTargetsFile(*targetsFilePtr, targets); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *dnsSDNamePtr != "" {
+		if *dnsSDIntervalPtr < 1 {
+			log.Fatalf("Invalid --dns-sd.interval %d, must be at least 1", *dnsSDIntervalPtr)
+		}
+		if err := discoverSRV(*dnsSDNamePtr, *dnsSDSchemePtr, time.Duration(*dnsSDIntervalPtr)*time.Second, targets); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *consulServicePtr != "" {
+		err := discoverConsul(consulOptions{
+			address: *consulAddressPtr,
+			service: *consulServicePtr,
+			tag:     *consulTagPtr,
+			token:   *consulTokenPtr,
+			scheme:  *consulSchemePtr,
+		}, targets)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *kubeSelectorPtr != "" {
+		if *kubeIntervalPtr < 1 {
+			log.Fatalf("Invalid --kubernetes.interval %d, must be at least 1", *kubeIntervalPtr)
+		}
+		err := discoverKubernetes(kubernetesOptions{
+			kubeconfig: *kubeconfigPtr,
+			role:       *kubeRolePtr,
+			namespace:  *kubeNamespacePtr,
+			selector:   *kubeSelectorPtr,
+			port:       *kubePortPtr,
+		}, time.Duration(*kubeIntervalPtr)*time.Second, targets)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *dockerSocketPtr != "" {
+		if err := discoverDocker(*dockerSocketPtr, targets); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var lsPoller *liquidsoapPoller
+	if *liquidsoapPtr != "" {
+		outputs := parseList(*liquidsoapOutputsPtr)
+		if len(outputs) == 0 {
+			log.Fatalf("Missing argument --liquidsoap.outputs, see '%s --help' for information", os.Args[0])
+		}
+		log.Println("monitor Liquidsoap at", *liquidsoapPtr)
+		lsPoller = newLiquidsoapPoller(*liquidsoapPtr, outputs)
+	}
+
+	if once {
+		os.Exit(scrapeOnce(targets.pollers(), lsPoller))
+	}
+
+	var handler http.Handler = promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	if *openMetricsPtr {
+		handler = newOpenMetricsHandler(reg, handler)
+	}
+	var refresh func()
+	if *onDemandPtr {
+		log.Println("poll Icecast on demand, caching results for", *cacheMaxAgePtr, "seconds")
+		cache := &scrapeCache{targets: targets, maxAge: time.Duration(*cacheMaxAgePtr) * time.Second}
+		handler = cache.handler(handler)
+		refresh = cache.refresh
+	}
+
+	if lsPoller != nil {
+		updateLiquidsoap(lsPoller, *waitPtr)
+	}
+
+	if *textfilePtr != "" {
+		textfileInterval := interval
+		if *textfileIntervalPtr > 0 {
+			textfileInterval = time.Duration(*textfileIntervalPtr) * time.Second
+		}
+		log.Println("write metrics to textfile", *textfilePtr)
+		writeTextfile(*textfilePtr, textfileInterval, refresh)
+	}
+
+	if *pushURLPtr != "" {
+		grouping, err := parseLabelPairs(*pushGroupingPtr)
+		if err != nil {
+			log.Fatalf("Invalid --push.grouping: %v", err)
+		}
+		pushInterval := interval
+		if *pushIntervalPtr > 0 {
+			pushInterval = time.Duration(*pushIntervalPtr) * time.Second
+		}
+		log.Println("push metrics to", *pushURLPtr)
+		pushMetrics(pushOptions{
+			url:      *pushURLPtr,
+			job:      *pushJobPtr,
+			grouping: grouping,
+			username: *pushUsernamePtr,
+			password: *pushPasswordPtr,
+		}, pushInterval, refresh)
+	}
+
+	if *remoteWriteURLPtr != "" {
+		externalLabels, err := parseLabelPairs(*remoteWriteLabelsPtr)
+		if err != nil {
+			log.Fatalf("Invalid --remote-write.external-labels: %v", err)
+		}
+		remoteWriteInterval := interval
+		if *remoteWriteIntervalPtr > 0 {
+			remoteWriteInterval = time.Duration(*remoteWriteIntervalPtr) * time.Second
+		}
+		log.Println("remote write metrics to", *remoteWriteURLPtr)
+		remoteWrite(remoteWriteOptions{
+			url:            *remoteWriteURLPtr,
+			externalLabels: externalLabels,
+			bearerToken:    *remoteWriteTokenPtr,
+			username:       *remoteWriteUsernamePtr,
+			password:       *remoteWritePasswordPtr,
+		}, remoteWriteInterval, refresh)
+	}
+
+	if *otlpEndpointPtr != "" {
+		headers, err := parseLabelPairs(*otlpHeadersPtr)
+		if err != nil {
+			log.Fatalf("Invalid --otlp.headers: %v", err)
+		}
+		attributes, err := parseLabelPairs(*otlpAttributesPtr)
+		if err != nil {
+			log.Fatalf("Invalid --otlp.resource-attributes: %v", err)
+		}
+		otlpInterval := interval
+		if *otlpIntervalPtr > 0 {
+			otlpInterval = time.Duration(*otlpIntervalPtr) * time.Second
+		}
+		log.Println("export metrics via OTLP to", *otlpEndpointPtr)
+		exportOTLP(otlpOptions{
+			endpoint:           *otlpEndpointPtr,
+			headers:            headers,
+			resourceAttributes: attributes,
+			pollers:            targets.pollers,
+			listenerOpts:       listenerOpts,
+		}, otlpInterval, refresh)
+	}
+
+	if *statsdAddressPtr != "" {
+		statsdInterval := interval
+		if *statsdIntervalPtr > 0 {
+			statsdInterval = time.Duration(*statsdIntervalPtr) * time.Second
+		}
+		log.Println("send metrics to StatsD at", *statsdAddressPtr)
+		sendStatsd(statsdOptions{
+			address:   *statsdAddressPtr,
+			prefix:    *statsdPrefixPtr,
+			dogstatsd: *statsdDogPtr,
+		}, statsdInterval, refresh)
+	}
+
+	if *graphiteAddressPtr != "" {
+		graphiteInterval := interval
+		if *graphiteIntervalPtr > 0 {
+			graphiteInterval = time.Duration(*graphiteIntervalPtr) * time.Second
+		}
+		log.Println("send metrics to Graphite at", *graphiteAddressPtr)
+		sendGraphite(graphiteOptions{
+			address: *graphiteAddressPtr,
+			prefix:  *graphitePrefixPtr,
+		}, graphiteInterval, refresh)
+	}
+
+	if *influxURLPtr != "" {
+		switch {
+		case *influxVersionPtr == 1 && *influxDatabasePtr == "":
+			log.Fatalf("Missing argument --influxdb.database, see '%s --help' for information", os.Args[0])
+		case *influxVersionPtr == 2 && (*influxOrgPtr == "" || *influxBucketPtr == ""):
+			log.Fatalf("Missing argument --influxdb.org or --influxdb.bucket, see '%s --help' for information", os.Args[0])
+		case *influxVersionPtr != 1 && *influxVersionPtr != 2:
+			log.Fatalf("Invalid --influxdb.version %d, must be 1 or 2", *influxVersionPtr)
+		}
+		// defaults to the poll interval, the writes run on their own timer and
+		// are not synced with the polls
+		influxInterval := interval
+		if *influxIntervalPtr > 0 {
+			influxInterval = time.Duration(*influxIntervalPtr) * time.Second
+		}
+		log.Println("write metrics to InfluxDB at", *influxURLPtr)
+		writeInflux(influxOptions{
+			url:      *influxURLPtr,
+			version:  *influxVersionPtr,
+			database: *influxDatabasePtr,
+			username: *influxUsernamePtr,
+			password: *influxPasswordPtr,
+			token:    *influxTokenPtr,
+			org:      *influxOrgPtr,
+			bucket:   *influxBucketPtr,
+		}, influxInterval, refresh)
+	}
+
+	watchdog(targets)
+
+	// an empty address disables the HTTP server, e.g. when only writing a textfile
+	if *listenAddressPtr == "" {
+		select {}
+	}
+
+	http.Handle(*telemetryPathPtr, handler)
+	http.Handle("/api/v1/streams", streamsAPI(targets, refresh, *corsOriginPtr))
+	http.Handle("/dashboard/", dashboardHandler())
+	if *debugStatePtr {
+		http.Handle("/debug/state", debugStateHandler(targets, publishers, started))
+		http.Handle("/debug/last-scrape", lastScrapeHandler(targets, listenerOpts))
+	}
+	listener, err := net.Listen("tcp", *listenAddressPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// without background polls the exporter is ready once it accepts scrapes
+	if *onDemandPtr {
+		notifyReady()
+	}
+	log.Fatal(http.Serve(listener, nil))
+}
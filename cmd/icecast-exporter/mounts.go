@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+// MountConfig polls the mounts matching a pattern more often than their
+// target
+type MountConfig struct {
+	// pattern of the mounts like live.mp3 or news-*, see path.Match
+	Mount    string        `yaml:"mount"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (c MountConfig) validate(target time.Duration) error {
+	if _, err := path.Match(c.Mount, ""); err != nil || c.Mount == "" {
+		return fmt.Errorf("invalid mount pattern %q", c.Mount)
+	}
+	if c.Interval <= 0 || c.Interval >= target {
+		return fmt.Errorf("interval %s of mount %s must be positive and shorter than the interval %s of the target", c.Interval, c.Mount, target)
+	}
+	return nil
+}
+
+// mountPath returns the mount of a stream on the server, the path of its
+// listen URL as the mount label is only its last element
+func mountPath(s collector.Stream) string {
+	if listen, err := url.Parse(s.ListenURL); err == nil && listen.Path != "" {
+		return listen.Path
+	}
+	return "/" + s.Mount
+}
+
+// mountURL returns the status URL only reporting the mount of a stream
+func mountURL(target string, s collector.Stream) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("mount", mountPath(s))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// matchMounts returns the streams of the last poll matching the pattern of
+// the mount override i and none of the ones before
+func (p *poller) matchMounts(i int) []collector.Stream {
+	var matched []collector.Stream
+	for _, s := range p.lastStreams() {
+		for j, m := range p.mounts {
+			if ok, _ := path.Match(m.Mount, s.Mount); ok {
+				if j == i {
+					matched = append(matched, s)
+				}
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// pollMounts polls the mounts with their own interval in between the polls
+// of the target until the next one is due, it returns false once the poller
+// is stopped. Mounts are only picked up by the polls of the target
+func (p *poller) pollMounts(until time.Time) bool {
+	now := time.Now()
+	due := make([]time.Time, len(p.mounts))
+	for i, m := range p.mounts {
+		due[i] = now.Add(m.Interval)
+	}
+	for {
+		next := until
+		// a failing target is only retried by its own backoff
+		if p.retry.failures == 0 {
+			for _, d := range due {
+				if d.Before(next) {
+					next = d
+				}
+			}
+		}
+		select {
+		case <-time.After(time.Until(next)):
+		case <-p.done:
+			return false
+		}
+		if !next.Before(until) {
+			return true
+		}
+		for i, m := range p.mounts {
+			if due[i].After(time.Now()) {
+				continue
+			}
+			for _, s := range p.matchMounts(i) {
+				p.pollMount(s)
+				if p.stopped() {
+					return false
+				}
+			}
+			due[i] = time.Now().Add(m.Interval)
+		}
+		if until.After(time.Now()) {
+			p.due.Store(until.Add(p.timeout))
+		}
+	}
+}
+
+// pollMount updates a single mount of the last poll, the source disconnected
+// if the status does not report it anymore
+func (p *poller) pollMount(stream collector.Stream) {
+	mount := mountPath(stream)
+	u, err := mountURL(p.url, stream)
+	if err != nil {
+		return
+	}
+	// every mount poll must finish in time for the watchdog, a long list of
+	// mounts may run past the end of the interval
+	p.due.Store(time.Now().Add(p.timeout))
+	p.slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	resp, err := p.client.Status(ctx, u)
+	cancel()
+	<-p.slots
+	if p.stopped() {
+		return
+	}
+	if err != nil {
+		scrapeErrors.WithLabelValues(p.url).Inc()
+		if err.Error() != p.lastMountErr {
+			log.Printf("Error polling mount %s of Icecast endpoint %s: %v", mount, p.url, err)
+		}
+		p.lastMountErr = err.Error()
+		return
+	}
+	p.lastMountErr = ""
+
+	var updated []collector.Stream
+	// servers ignoring the mount parameter report all mounts
+	for _, s := range collector.Streams(p.url, p.serverName, resp) {
+		if mountPath(s) == mount {
+			updated = append(updated, s)
+		}
+	}
+	for _, s := range p.lastStreams() {
+		if mountPath(s) != mount {
+			updated = append(updated, s)
+		}
+	}
+	p.streams.Store(updated)
+	// the values exported with timestamps changed
+	p.polledAt.Store(time.Now())
+	for _, pub := range p.publishers {
+		if c, ok := pub.(pollCounter); ok {
+			c.publishMount(p.url, stream.Mount, updated)
+			continue
+		}
+		pub.publish(p.url, updated)
+	}
+}
+
+// trimMountPatterns removes the leading slash of the mount patterns
+func trimMountPatterns(mounts []MountConfig) []MountConfig {
+	trimmed := make([]MountConfig, len(mounts))
+	for i, m := range mounts {
+		m.Mount = strings.TrimPrefix(m.Mount, "/")
+		trimmed[i] = m
+	}
+	return trimmed
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+type mqttOptions struct {
+	broker         string
+	clientID       string
+	username       string
+	password       string
+	listenersTopic string
+	// empty disables the up/down events
+	stateTopic string
+	qos        byte
+	retain     bool
+}
+
+const mqttTimeout = 5 * time.Second
+
+// mqttPublisher publishes the listeners of every stream and an up/down event
+// when a stream appears or disappears
+type mqttPublisher struct {
+	client         mqtt.Client
+	listenersTopic *template.Template
+	stateTopic     *template.Template
+	qos            byte
+	retain         bool
+
+	mu sync.Mutex
+	// streams of the last poll per target by listen url
+	up map[string]map[string]collector.Stream
+}
+
+func newMQTTPublisher(opts mqttOptions) (*mqttPublisher, error) {
+	listenersTopic, err := template.New("topic").Parse(opts.listenersTopic)
+	if err != nil {
+		return nil, err
+	}
+	var stateTopic *template.Template
+	if opts.stateTopic != "" {
+		if stateTopic, err = template.New("state-topic").Parse(opts.stateTopic); err != nil {
+			return nil, err
+		}
+	}
+
+	clientOpts := mqtt.NewClientOptions().
+		AddBroker(opts.broker).
+		SetClientID(opts.clientID).
+		SetUsername(opts.username).
+		SetPassword(opts.password).
+		SetAutoReconnect(true).
+		// keep retrying in the background if the broker is not reachable at startup
+		SetConnectRetry(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Println("Lost connection to MQTT broker:", err)
+		})
+
+	client := mqtt.NewClient(clientOpts)
+	client.Connect()
+
+	return &mqttPublisher{
+		client:         client,
+		listenersTopic: listenersTopic,
+		stateTopic:     stateTopic,
+		qos:            opts.qos,
+		retain:         opts.retain,
+		up:             map[string]map[string]collector.Stream{},
+	}, nil
+}
+
+func (m *mqttPublisher) send(topic *template.Template, s collector.Stream, payload string) {
+	// messages are dropped instead of queued while the broker is unreachable,
+	// the next poll publishes current values anyway
+	if !m.client.IsConnectionOpen() {
+		return
+	}
+
+	t, err := executeTemplate(topic, s)
+	if err != nil {
+		log.Println("Error rendering MQTT topic:", err)
+		return
+	}
+
+	token := m.client.Publish(t, m.qos, m.retain, payload)
+	go func() {
+		if !token.WaitTimeout(mqttTimeout) {
+			log.Println("Timeout publishing to MQTT topic", t)
+		} else if err := token.Error(); err != nil {
+			log.Printf("Error publishing to MQTT topic %s: %v", t, err)
+		}
+	}()
+}
+
+func (m *mqttPublisher) publish(target string, streams []collector.Stream) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := map[string]collector.Stream{}
+	for _, s := range streams {
+		m.send(m.listenersTopic, s, strconv.Itoa(s.Listeners))
+		if _, ok := m.up[target][s.ListenURL]; !ok && m.stateTopic != nil {
+			m.send(m.stateTopic, s, "up")
+		}
+		seen[s.ListenURL] = s
+	}
+	for listenURL, s := range m.up[target] {
+		if _, ok := seen[listenURL]; !ok && m.stateTopic != nil {
+			m.send(m.stateTopic, s, "down")
+		}
+	}
+	m.up[target] = seen
+}
+
+func (m *mqttPublisher) forget(target string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.up, target)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+var sourceUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "icecast_source_up",
+	Help: "Whether an expected mount is connected on any target",
+}, []string{"mount"})
+
+// NotifierConfig configures a chat notification for disconnects and
+// recoveries of expected mounts
+type NotifierConfig struct {
+	// slack, discord or ntfy
+	Type string `yaml:"type"`
+	// incoming webhook URL or ntfy topic URL
+	URL string `yaml:"url"`
+	// Slack channel, overrides the default channel of the webhook
+	Channel string `yaml:"channel"`
+	// ntfy access token and message priority
+	Token    string `yaml:"token"`
+	Priority string `yaml:"priority"`
+	// minimum time between two messages, messages in between are combined
+	MinInterval time.Duration `yaml:"min_interval"`
+}
+
+type notifier struct {
+	NotifierConfig
+	messages chan string
+}
+
+func (c NotifierConfig) validate() error {
+	switch c.Type {
+	case "slack", "discord", "ntfy":
+	default:
+		return fmt.Errorf("unknown notifier type %q, must be slack, discord or ntfy", c.Type)
+	}
+	if c.URL == "" {
+		return fmt.Errorf("%s notifier has no url", c.Type)
+	}
+	return nil
+}
+
+func newNotifier(c NotifierConfig) (*notifier, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	n := &notifier{NotifierConfig: c, messages: make(chan string, 100)}
+	go n.run()
+	return n, nil
+}
+
+func (n *notifier) notify(msg string) {
+	select {
+	case n.messages <- msg:
+	default:
+		log.Printf("Dropping %s notification, queue is full: %s", n.Type, msg)
+	}
+}
+
+// run sends queued messages, combining all messages that arrive while the
+// notifier is rate limited into a single one
+func (n *notifier) run() {
+	var last time.Time
+	for msg := range n.messages {
+		if wait := n.MinInterval - time.Since(last); wait > 0 {
+			time.Sleep(wait)
+		}
+		pending := []string{msg}
+	drain:
+		for {
+			select {
+			case m := <-n.messages:
+				pending = append(pending, m)
+			default:
+				break drain
+			}
+		}
+		last = time.Now()
+		if err := n.send(strings.Join(pending, "\n")); err != nil {
+			log.Printf("Error sending %s notification: %v", n.Type, err)
+		}
+	}
+}
+
+func (n *notifier) send(msg string) error {
+	var req *http.Request
+	var err error
+
+	switch n.Type {
+	case "slack":
+		payload := map[string]string{"text": msg}
+		if n.Channel != "" {
+			payload["channel"] = n.Channel
+		}
+		req, err = jsonRequest(n.URL, payload)
+	case "discord":
+		req, err = jsonRequest(n.URL, map[string]string{"content": msg})
+	case "ntfy":
+		req, err = http.NewRequest(http.MethodPost, n.URL, strings.NewReader(msg))
+		if err == nil {
+			req.Header.Set("Title", "Icecast")
+			if n.Priority != "" {
+				req.Header.Set("Priority", n.Priority)
+			}
+			if n.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+n.Token)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return nil
+}
+
+func jsonRequest(url string, payload interface{}) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// expectedMounts tracks whether the expected mounts are connected on any
+// target and notifies on disconnects and recoveries
+type expectedMounts struct {
+	mounts    []string
+	notifiers []*notifier
+	// mounts are only evaluated once all targets have been polled or the
+	// grace period has passed, avoiding false disconnects at startup
+	targets func() int
+	started time.Time
+	grace   time.Duration
+
+	mu sync.Mutex
+	// streams of the last poll per target
+	streams map[string][]collector.Stream
+	// connection state of the mounts, missing until the first poll
+	up map[string]bool
+}
+
+func newExpectedMounts(mounts []string, notifiers []*notifier, targets func() int, grace time.Duration) *expectedMounts {
+	reg.MustRegister(sourceUp)
+
+	e := &expectedMounts{
+		notifiers: notifiers,
+		targets:   targets,
+		started:   time.Now(),
+		grace:     grace,
+		streams:   map[string][]collector.Stream{},
+		up:        map[string]bool{},
+	}
+	for _, m := range mounts {
+		e.mounts = append(e.mounts, strings.TrimPrefix(m, "/"))
+	}
+	return e
+}
+
+func (e *expectedMounts) queues() []debugQueue {
+	var queues []debugQueue
+	for _, n := range e.notifiers {
+		queues = append(queues, debugQueue{Name: n.Type + " notifier", Length: len(n.messages), Capacity: cap(n.messages)})
+	}
+	return queues
+}
+
+func (e *expectedMounts) publish(target string, streams []collector.Stream) {
+	targets := e.targets()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.streams[target] = streams
+	if len(e.streams) < targets && time.Since(e.started) < e.grace {
+		return
+	}
+
+	connected := map[string]bool{}
+	for _, streams := range e.streams {
+		for _, s := range streams {
+			connected[s.Mount] = true
+		}
+	}
+
+	for _, m := range e.mounts {
+		up, known := e.up[m]
+		if connected[m] {
+			sourceUp.WithLabelValues(m).Set(1)
+		} else {
+			sourceUp.WithLabelValues(m).Set(0)
+		}
+		if known && up == connected[m] {
+			continue
+		}
+		e.up[m] = connected[m]
+
+		// a mount that is connected at startup is not worth a message
+		var msg string
+		switch {
+		case !connected[m]:
+			msg = fmt.Sprintf("source /%s disconnected", m)
+		case known:
+			msg = fmt.Sprintf("source /%s recovered", m)
+		default:
+			continue
+		}
+		log.Println(msg)
+		for _, n := range e.notifiers {
+			n.notify(msg)
+		}
+	}
+}
+
+// forget removes the streams of a target, its mounts count as disconnected
+// with the next poll of any other target
+func (e *expectedMounts) forget(target string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.streams, target)
+}
+
+// pollFailed counts the mounts of a target that cannot be polled as
+// disconnected, so an outage of the whole server is notified
+func (e *expectedMounts) pollFailed(target string) {
+	e.publish(target, nil)
+}
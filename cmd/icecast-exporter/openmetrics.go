@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// openMetricsHandler serves the OpenMetrics format with a _created sample
+// for every counter, which the encoder of the prometheus client does not
+// write. Other formats are served by next
+type openMetricsHandler struct {
+	gatherer prometheus.Gatherer
+	next     http.Handler
+
+	mu sync.Mutex
+	// creation time by counter series
+	created    map[string]time.Time
+	lastGather time.Time
+}
+
+func newOpenMetricsHandler(gatherer prometheus.Gatherer, next http.Handler) *openMetricsHandler {
+	return &openMetricsHandler{
+		gatherer: gatherer,
+		next:     next,
+		created:  map[string]time.Time{},
+		// counters seen in the first gather are taken as created on start
+		lastGather: time.Now(),
+	}
+}
+
+func (h *openMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if expfmt.NegotiateIncludingOpenMetrics(r.Header) != expfmt.FmtOpenMetrics {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	families, err := h.gatherer.Gather()
+	if err != nil {
+		log.Println("Error gathering metrics:", err)
+		http.Error(w, "error gathering metrics: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created := h.createdTimes(families)
+
+	var buf bytes.Buffer
+	for _, mf := range families {
+		if err := writeOpenMetricsFamily(&buf, mf, created); err != nil {
+			log.Println("Error encoding metrics:", err)
+			http.Error(w, "error encoding metrics: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	expfmt.FinalizeOpenMetrics(&buf)
+
+	w.Header().Set("Content-Type", string(expfmt.FmtOpenMetrics))
+	var out io.Writer = w
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	if _, err := buf.WriteTo(out); err != nil {
+		log.Println("Error writing metrics:", err)
+	}
+}
+
+// createdTimes returns the creation time of every counter series. A series
+// is only known once it is gathered, so the time of the previous gather is
+// used, the latest time it surely did not exist yet
+func (h *openMetricsHandler) createdTimes(families []*dto.MetricFamily) map[string]time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seen := map[string]time.Time{}
+	for _, mf := range families {
+		if mf.GetType() != dto.MetricType_COUNTER {
+			continue
+		}
+		for _, m := range mf.Metric {
+			key := mf.GetName() + openMetricsLabels(m.Label)
+			t, ok := h.created[key]
+			if !ok {
+				t = h.lastGather
+			}
+			seen[key] = t
+		}
+	}
+	// deleted series get a new creation time when they come back
+	h.created = seen
+	h.lastGather = time.Now()
+	return seen
+}
+
+// writeOpenMetricsFamily writes a family like expfmt, adding the _created
+// sample after every sample of a counter
+func writeOpenMetricsFamily(w *bytes.Buffer, mf *dto.MetricFamily, created map[string]time.Time) error {
+	name := mf.GetName()
+	if mf.GetType() != dto.MetricType_COUNTER || !strings.HasSuffix(name, "_total") {
+		_, err := expfmt.MetricFamilyToOpenMetrics(w, mf)
+		return err
+	}
+
+	var family bytes.Buffer
+	if _, err := expfmt.MetricFamilyToOpenMetrics(&family, mf); err != nil {
+		return err
+	}
+	// the comments come first, then exactly one line per counter
+	lines := strings.SplitAfter(strings.TrimSuffix(family.String(), "\n"), "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], "# ") {
+		w.WriteString(lines[i])
+		i++
+	}
+	if len(lines)-i != len(mf.Metric) {
+		return fmt.Errorf("unexpected number of samples of %s", name)
+	}
+	for j, m := range mf.Metric {
+		w.WriteString(strings.TrimSuffix(lines[i+j], "\n"))
+		w.WriteByte('\n')
+
+		labels := openMetricsLabels(m.Label)
+		t := created[name+labels]
+		fmt.Fprintf(w, "%s_created%s %s\n", strings.TrimSuffix(name, "_total"), labels,
+			strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64))
+	}
+	return nil
+}
+
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func openMetricsLabels(labels []*dto.LabelPair) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.GetName())
+		b.WriteString(`="`)
+		openMetricsEscaper.WriteString(&b, l.GetValue())
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+type otlpOptions struct {
+	endpoint           string
+	headers            map[string]string
+	resourceAttributes map[string]string
+	// the listeners are collected per target for its resource
+	pollers      func() []*poller
+	listenerOpts collector.Options
+}
+
+var (
+	otlpClient = &http.Client{Timeout: 30 * time.Second}
+	// start of the cumulative sums, counters start at zero with the process
+	otlpStartTime = time.Now()
+)
+
+// OTLP/HTTP JSON encoding of ExportMetricsServiceRequest, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          otlpDouble      `json:"asDouble"`
+}
+
+// otlpDouble encodes NaN and infinities as strings like the JSON mapping of
+// protobuf, encoding/json fails on them
+type otlpDouble float64
+
+func (d otlpDouble) MarshalJSON() ([]byte, error) {
+	v := float64(d)
+	switch {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Infinity"`), nil
+	}
+	return json.Marshal(v)
+}
+
+type otlpAttribute struct {
+	Key   string             `json:"key"`
+	Value otlpAttributeValue `json:"value"`
+}
+
+type otlpAttributeValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+const otlpCumulative = 2
+
+func otlpAttributes(labels map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		attributes = append(attributes, otlpAttribute{Key: k, Value: otlpAttributeValue{StringValue: labels[k]}})
+	}
+	return attributes
+}
+
+func otlpLabels(pairs []*dto.LabelPair) map[string]string {
+	labels := map[string]string{}
+	for _, l := range pairs {
+		labels[l.GetName()] = l.GetValue()
+	}
+	return labels
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpMetrics converts gauges and counters into OTLP gauges and cumulative
+// sums, grouped by their target label which becomes a resource attribute.
+// Series without one are keyed by target
+func otlpMetrics(families []*dto.MetricFamily, target string, now string, metrics map[string][]otlpMetric) {
+	for _, mf := range families {
+		points := map[string][]otlpDataPoint{}
+		var targets []string
+		for _, m := range mf.GetMetric() {
+			labels := otlpLabels(m.GetLabel())
+			key := target
+			if t, ok := labels["target"]; ok && target == "" {
+				key = t
+				delete(labels, "target")
+			}
+			point := otlpDataPoint{Attributes: otlpAttributes(labels), TimeUnixNano: now}
+			switch mf.GetType() {
+			case dto.MetricType_GAUGE:
+				point.AsDouble = otlpDouble(m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				point.AsDouble = otlpDouble(m.GetUntyped().GetValue())
+			case dto.MetricType_COUNTER:
+				point.AsDouble = otlpDouble(m.GetCounter().GetValue())
+				point.StartTimeUnixNano = unixNano(otlpStartTime)
+			default:
+				continue
+			}
+			if _, ok := points[key]; !ok {
+				targets = append(targets, key)
+			}
+			points[key] = append(points[key], point)
+		}
+
+		for _, t := range targets {
+			metric := otlpMetric{Name: mf.GetName(), Description: mf.GetHelp()}
+			if mf.GetType() == dto.MetricType_COUNTER {
+				metric.Sum = &otlpSum{DataPoints: points[t], AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			} else {
+				metric.Gauge = &otlpGauge{DataPoints: points[t]}
+			}
+			metrics[t] = append(metrics[t], metric)
+		}
+	}
+}
+
+// buildRequest sends the metrics of every Icecast target as its own
+// resource with the server as attribute, the remaining metrics of the
+// exporter as a resource without one
+func (o otlpOptions) buildRequest() (*otlpRequest, error) {
+	families, err := reg.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	now := unixNano(time.Now())
+	metrics := map[string][]otlpMetric{}
+	// the listeners of the registry are summed over all targets
+	var rest []*dto.MetricFamily
+	for _, mf := range families {
+		switch mf.GetName() {
+		case "icecast_listeners", "icecast_listeners_by_format":
+		default:
+			rest = append(rest, mf)
+		}
+	}
+	otlpMetrics(rest, "", now, metrics)
+	for _, p := range o.pollers() {
+		streams := []collector.TargetStreams{{Labels: p.labels, Streams: p.lastStreams()}}
+		listeners := prometheus.NewRegistry()
+		listeners.MustRegister(collector.NewListenerCollector(func() []collector.TargetStreams { return streams }, o.listenerOpts))
+		families, err := listeners.Gather()
+		if err != nil {
+			return nil, err
+		}
+		otlpMetrics(families, p.url, now, metrics)
+	}
+
+	targets := make([]string, 0, len(metrics))
+	for t := range metrics {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+
+	request := &otlpRequest{ResourceMetrics: []otlpResourceMetrics{}}
+	for _, t := range targets {
+		resource := map[string]string{"service.name": "icecast-exporter"}
+		for k, v := range o.resourceAttributes {
+			resource[k] = v
+		}
+		if t != "" {
+			resource["icecast.target"] = redactURL(t)
+			if u, err := url.Parse(t); err == nil && u.Host != "" {
+				resource["server.address"] = u.Hostname()
+			}
+		}
+		request.ResourceMetrics = append(request.ResourceMetrics, otlpResourceMetrics{
+			Resource: otlpResource{Attributes: otlpAttributes(resource)},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: "github.com/zecktos/icecast-exporter"},
+				Metrics: metrics[t],
+			}},
+		})
+	}
+	return request, nil
+}
+
+func (o otlpOptions) export() error {
+	request, err := o.buildRequest()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(o.endpoint, "/")+"/v1/metrics", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range o.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := otlpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("unexpected HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// exportOTLP periodically sends all metrics to an OTLP/HTTP receiver, gRPC
+// is not supported as it would pull in the gRPC module
+func exportOTLP(opts otlpOptions, interval time.Duration, refresh func()) {
+	runOutput("OTLP", interval, refresh, opts.export)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLPDouble(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{12, `12`},
+		{0.25, `0.25`},
+		{math.NaN(), `"NaN"`},
+		{math.Inf(1), `"Infinity"`},
+		{math.Inf(-1), `"-Infinity"`},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(otlpDouble(tt.value))
+		if err != nil {
+			t.Fatalf("json.Marshal(%v): %v", tt.value, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("json.Marshal(%v) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func gaugeFamily(name string, metrics ...*dto.Metric) *dto.MetricFamily {
+	return &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_GAUGE.Enum(), Metric: metrics}
+}
+
+func gauge(value float64, labels ...*dto.LabelPair) *dto.Metric {
+	return &dto.Metric{Label: labels, Gauge: &dto.Gauge{Value: proto.Float64(value)}}
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	families := []*dto.MetricFamily{
+		gaugeFamily("icecast_poll_backoff_seconds",
+			gauge(0, labelPair("target", "http://a/status-json.xsl")),
+			gauge(math.NaN(), labelPair("target", "http://b/status-json.xsl"))),
+		gaugeFamily("icecast_discovered_targets", gauge(2, labelPair("provider", "config"))),
+		{
+			Name:   proto.String("icecast_scrape_errors_total"),
+			Type:   dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{Label: []*dto.LabelPair{labelPair("target", "http://a/status-json.xsl")}, Counter: &dto.Counter{Value: proto.Float64(3)}}},
+		},
+		// summaries are not exported
+		{Name: proto.String("icecast_summary"), Type: dto.MetricType_SUMMARY.Enum(), Metric: []*dto.Metric{{Summary: &dto.Summary{}}}},
+	}
+
+	metrics := map[string][]otlpMetric{}
+	otlpMetrics(families, "", "1", metrics)
+
+	names := map[string][]string{}
+	for target, ms := range metrics {
+		for _, m := range ms {
+			names[target] = append(names[target], m.Name)
+		}
+	}
+	want := map[string][]string{
+		"http://a/status-json.xsl": {"icecast_poll_backoff_seconds", "icecast_scrape_errors_total"},
+		"http://b/status-json.xsl": {"icecast_poll_backoff_seconds"},
+		"":                         {"icecast_discovered_targets"},
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("metrics by target = %v, want %v", names, want)
+	}
+
+	// the target is an attribute of the resource, not of the data points
+	for _, m := range metrics["http://a/status-json.xsl"] {
+		var points []otlpDataPoint
+		if m.Gauge != nil {
+			points = m.Gauge.DataPoints
+		} else {
+			points = m.Sum.DataPoints
+			if !m.Sum.IsMonotonic || m.Sum.AggregationTemporality != otlpCumulative {
+				t.Errorf("%s is not a monotonic cumulative sum", m.Name)
+			}
+		}
+		for _, p := range points {
+			if len(p.Attributes) != 0 {
+				t.Errorf("%s has data point attributes %v", m.Name, p.Attributes)
+			}
+		}
+	}
+
+	// NaN must not fail the whole export
+	if _, err := json.Marshal(metrics); err != nil {
+		t.Errorf("json.Marshal: %v", err)
+	}
+}
+
+func TestOTLPMetricsOfTarget(t *testing.T) {
+	families := []*dto.MetricFamily{
+		gaugeFamily("icecast_listeners", gauge(12, labelPair("server_name", "Radio"), labelPair("stream_url", "live.mp3"))),
+	}
+	metrics := map[string][]otlpMetric{}
+	otlpMetrics(families, "http://a/status-json.xsl", "1", metrics)
+
+	got := metrics["http://a/status-json.xsl"]
+	if len(got) != 1 || len(got[0].Gauge.DataPoints) != 1 {
+		t.Fatalf("metrics of the target = %+v, want a single icecast_listeners point", got)
+	}
+	want := []otlpAttribute{
+		{Key: "server_name", Value: otlpAttributeValue{StringValue: "Radio"}},
+		{Key: "stream_url", Value: otlpAttributeValue{StringValue: "live.mp3"}},
+	}
+	if attributes := got[0].Gauge.DataPoints[0].Attributes; !reflect.DeepEqual(attributes, want) {
+		t.Errorf("attributes = %+v, want %+v", attributes, want)
+	}
+}
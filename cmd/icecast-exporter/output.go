@@ -0,0 +1,22 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// runOutput calls write every interval to ship the metrics to an output,
+// refresh is called before each write if set (on-demand polling)
+func runOutput(name string, interval time.Duration, refresh func(), write func() error) {
+	go func() {
+		for {
+			if refresh != nil {
+				refresh()
+			}
+			if err := write(); err != nil {
+				log.Printf("Error writing metrics to %s: %v", name, err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
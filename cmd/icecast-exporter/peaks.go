@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+// rollingBuckets is the number of buckets a window is divided into, the
+// peak or availability of a window may include up to one bucket of older
+// samples
+const rollingBuckets = 96
+
+var peakDesc = prometheus.NewDesc("icecast_listeners_peak",
+	"Maximum of the listeners of a stream over a rolling window, collected by the exporter",
+	[]string{"target", "stream_url", "window"}, nil)
+
+// rollingWindow is a window of the peak listeners or the availability,
+// labeled as given on the command line
+type rollingWindow struct {
+	label    string
+	duration time.Duration
+}
+
+type peakBucket struct {
+	Start time.Time `json:"start"`
+	Max   int       `json:"max"`
+}
+
+func (b peakBucket) start() time.Time { return b.Start }
+
+// peakTracker keeps the rolling peak listeners of every stream, it is fed by
+// the polls and collected as icecast_listeners_peak
+type peakTracker struct {
+	*rollingState[peakBucket]
+	legacyLabel bool
+}
+
+// parseRollingWindows parses a comma separated list of windows like 24h,7d
+func parseRollingWindows(s string) ([]rollingWindow, error) {
+	var windows []rollingWindow
+	for _, w := range strings.Split(s, ",") {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		d, err := model.ParseDuration(w)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid window %s", w)
+		}
+		windows = append(windows, rollingWindow{label: w, duration: time.Duration(d)})
+	}
+	return windows, nil
+}
+
+func newPeakTracker(windows []rollingWindow, stateFile string, legacyLabel bool) *peakTracker {
+	t := &peakTracker{
+		rollingState: newRollingState[peakBucket](windows, stateFile, "peak listeners"),
+		legacyLabel:  legacyLabel,
+	}
+	reg.MustRegister(t)
+	return t
+}
+
+func streamKey(target, mount string) string {
+	return target + "\xff" + mount
+}
+
+func (t *peakTracker) publish(target string, streams []collector.Stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range streams {
+		series := t.seriesOf(target, s.Mount)
+		for _, w := range t.windows {
+			buckets := bucketAt(series.Buckets[w.label], now, w, func(start time.Time) peakBucket {
+				return peakBucket{Start: start}
+			})
+			if last := &buckets[len(buckets)-1]; s.Listeners > last.Max {
+				last.Max = s.Listeners
+			}
+			series.Buckets[w.label] = expireBuckets(buckets, now, w.duration)
+		}
+	}
+}
+
+func (t *peakTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- peakDesc
+}
+
+func (t *peakTracker) Collect(ch chan<- prometheus.Metric) {
+	// streams not seen during any window are forgotten
+	t.collect(func(s *rollingSeries[peakBucket], w rollingWindow, buckets []peakBucket) bool {
+		if len(buckets) == 0 {
+			return false
+		}
+		peak := 0
+		for _, b := range buckets {
+			if b.Max > peak {
+				peak = b.Max
+			}
+		}
+		mount := s.Mount
+		if t.legacyLabel {
+			mount = collector.LegacyLabel(mount)
+		}
+		ch <- prometheus.MustNewConstMetric(peakDesc, prometheus.GaugeValue, float64(peak), s.Target, mount, w.label)
+		return true
+	})
+}
+
+// rollingBucket is a bucket of a rolling window, e.g. a peakBucket
+type rollingBucket interface {
+	start() time.Time
+}
+
+type rollingSeries[B rollingBucket] struct {
+	Target string `json:"target"`
+	Mount  string `json:"mount"`
+	// buckets per window, oldest first
+	Buckets map[string][]B `json:"buckets"`
+}
+
+// rollingState keeps the buckets of the rolling windows of every stream and
+// persists them in a state file, shared by the peak listeners and the
+// availability
+type rollingState[B rollingBucket] struct {
+	windows   []rollingWindow
+	stateFile string
+
+	mu sync.Mutex
+	// series by target and mount
+	series map[string]*rollingSeries[B]
+}
+
+// newRollingState loads the state file if set, what names the state in logs
+func newRollingState[B rollingBucket](windows []rollingWindow, stateFile, what string) *rollingState[B] {
+	r := &rollingState[B]{
+		windows:   windows,
+		stateFile: stateFile,
+		series:    map[string]*rollingSeries[B]{},
+	}
+	if stateFile != "" {
+		if err := r.load(); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error loading %s state: %v", what, err)
+		}
+	}
+	return r
+}
+
+// seriesOf returns the series of a stream, creating it if needed. The caller
+// holds mu
+func (r *rollingState[B]) seriesOf(target, mount string) *rollingSeries[B] {
+	key := streamKey(target, mount)
+	series, ok := r.series[key]
+	if !ok {
+		series = &rollingSeries[B]{Target: target, Mount: mount, Buckets: map[string][]B{}}
+		r.series[key] = series
+	}
+	return series
+}
+
+// bucketAt returns the buckets with the bucket of now last, appended by
+// newBucket if it does not exist yet
+func bucketAt[B rollingBucket](buckets []B, now time.Time, w rollingWindow, newBucket func(start time.Time) B) []B {
+	start := now.Truncate(w.duration / rollingBuckets)
+	if n := len(buckets); n == 0 || !buckets[n-1].start().Equal(start) {
+		buckets = append(buckets, newBucket(start))
+	}
+	return buckets
+}
+
+// expireBuckets drops the buckets that ended before the window
+func expireBuckets[B rollingBucket](buckets []B, now time.Time, window time.Duration) []B {
+	size := window / rollingBuckets
+	i := 0
+	for i < len(buckets) && buckets[i].start().Add(size).Before(now.Add(-window)) {
+		i++
+	}
+	return buckets[i:]
+}
+
+// collect calls export with the unexpired buckets of every series and
+// window, series for which it never returns true are forgotten
+func (r *rollingState[B]) collect(export func(s *rollingSeries[B], w rollingWindow, buckets []B) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, s := range r.series {
+		keep := false
+		for _, w := range r.windows {
+			buckets := expireBuckets(s.Buckets[w.label], now, w.duration)
+			s.Buckets[w.label] = buckets
+			if export(s, w, buckets) {
+				keep = true
+			}
+		}
+		if !keep {
+			delete(r.series, key)
+		}
+	}
+}
+
+func (r *rollingState[B]) forget(target string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, s := range r.series {
+		if s.Target == target {
+			delete(r.series, key)
+		}
+	}
+}
+
+func (r *rollingState[B]) load() error {
+	data, err := os.ReadFile(r.stateFile)
+	if err != nil {
+		return err
+	}
+	var series []*rollingSeries[B]
+	if err := json.Unmarshal(data, &series); err != nil {
+		return fmt.Errorf("error parsing %s: %w", r.stateFile, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range series {
+		if s.Buckets == nil {
+			s.Buckets = map[string][]B{}
+		}
+		r.series[streamKey(s.Target, s.Mount)] = s
+	}
+	return nil
+}
+
+func (r *rollingState[B]) save() error {
+	r.mu.Lock()
+	series := make([]*rollingSeries[B], 0, len(r.series))
+	for _, s := range r.series {
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return streamKey(series[i].Target, series[i].Mount) < streamKey(series[j].Target, series[j].Mount)
+	})
+	data, err := json.Marshal(series)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.stateFile, data)
+}
+
+// writeFileAtomic writes to a temporary file first and renames it, so a crash
+// never leaves a partial state file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveState periodically persists the state of the peak listeners or the
+// availability
+func saveState(what string, save func() error, interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			if err := save(); err != nil {
+				log.Printf("Error saving %s state: %v", what, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+// poller periodically collects the listeners of a single Icecast target
+type poller struct {
+	url string
+	// additional labels of all series of the target, e.g. from service discovery
+	labels     map[string]string
+	serverName string
+	// cluster of the edge, empty for other targets
+	cluster  string
+	interval time.Duration
+	// mounts polled on their own in between the polls of the target
+	mounts       []MountConfig
+	lastMountErr string
+	// delay before the first poll, spreads the polls of multiple targets
+	// across the interval
+	offset  time.Duration
+	timeout time.Duration
+	client  *icecast.Client
+	// counts listener connects and disconnects, nil without admin credentials
+	churn *listenerChurn
+	// tracks the relayed mounts, nil without relays
+	relays *relayStatus
+	// exports the listener authentication counters, nil without admin
+	// credentials or configured stats
+	auth *authCounters
+	// loads the admin stats for relays and auth, nil without admin credentials
+	admin *icecast.Client
+	// scheme and host of the target
+	server       string
+	lastAdminErr string
+	// shared by all pollers, limits the number of concurrent scrapes
+	slots      chan struct{}
+	publishers []streamPublisher
+
+	retry   *backoff
+	retryAt time.Time
+	lastErr string
+	done    chan struct{}
+
+	// []collector.Stream of the last successful poll, exported by the listener collector
+	streams atomic.Value
+	// time.Time of the last successful poll
+	polledAt atomic.Value
+	// pollResult of the last poll, for the debug state
+	result atomic.Value
+	// keep the last status response in lastResponse for debugging
+	keepResponse bool
+	lastResponse atomic.Value
+	// time.Time the next poll of the loop should have finished by, checked by
+	// the systemd watchdog
+	due atomic.Value
+}
+
+func newPoller(p poller, maxBackoff time.Duration) *poller {
+	p.retry = newBackoff(p.interval, maxBackoff)
+	p.done = make(chan struct{})
+
+	scrapeErrors.WithLabelValues(p.url)
+	pollBackoff.WithLabelValues(p.url).Set(0)
+	return &p
+}
+
+// stop ends the poll loop and removes the metrics of the target
+func (p *poller) stop() {
+	close(p.done)
+
+	scrapeErrors.DeleteLabelValues(p.url)
+	pollBackoff.DeleteLabelValues(p.url)
+	scrapeDuration.DeleteLabelValues(p.url)
+	if p.churn != nil {
+		p.churn.delete()
+	}
+	if p.relays != nil {
+		p.relays.delete()
+	}
+	if p.auth != nil {
+		p.auth.delete()
+	}
+}
+
+func (p *poller) stopped() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// lastStreams returns the streams of the last successful poll
+func (p *poller) lastStreams() []collector.Stream {
+	streams, _ := p.streams.Load().([]collector.Stream)
+	return streams
+}
+
+// lastPoll returns the time of the last successful poll, zero before the first
+func (p *poller) lastPoll() time.Time {
+	t, _ := p.polledAt.Load().(time.Time)
+	return t
+}
+
+// scrape polls the target once, waiting for a free slot and giving up after
+// the target's timeout
+func (p *poller) scrape() (*icecast.StatusRoot, error) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	start := time.Now()
+	stats, err := p.client.Status(ctx, p.url)
+	if !p.stopped() {
+		scrapeDuration.WithLabelValues(p.url).Set(time.Since(start).Seconds())
+	}
+	return stats, err
+}
+
+// poll scrapes the target and updates the metrics, it returns the delay until
+// the next poll
+func (p *poller) poll() (time.Duration, error) {
+	resp, err := p.scrape()
+
+	// the target was removed while polling, its metrics are already deleted
+	if p.stopped() {
+		return p.interval, err
+	}
+
+	if err != nil {
+		// keep the last good values instead of exporting data from a bad response
+		scrapeErrors.WithLabelValues(p.url).Inc()
+		// only log while the backoff is still growing or the error changes
+		// to avoid repeating the same line every poll
+		logErr := !p.retry.atMax() || err.Error() != p.lastErr
+		delay := p.retry.fail()
+		p.retryAt = time.Now().Add(delay)
+		pollBackoff.WithLabelValues(p.url).Set(delay.Seconds())
+		if logErr {
+			log.Printf("Error polling Icecast endpoint %s: %v, trying again in %s", p.url, err, delay.Round(time.Second))
+		}
+		p.lastErr = err.Error()
+		p.result.Store(pollResult{at: time.Now(), err: p.lastErr, failures: p.retry.failures, retryAt: p.retryAt})
+		for _, pub := range p.publishers {
+			if o, ok := pub.(pollFailureObserver); ok {
+				o.pollFailed(p.url)
+			}
+		}
+		return delay, err
+	}
+
+	if p.retry.failures > 0 {
+		log.Printf("Icecast endpoint %s recovered after %d failed polls", p.url, p.retry.failures)
+		p.retry.reset()
+		pollBackoff.WithLabelValues(p.url).Set(0)
+		p.lastErr = ""
+	}
+
+	// a status without sources simply removes all series of the target
+	collected := collector.Streams(p.url, p.serverName, resp)
+
+	p.streams.Store(collected)
+	p.polledAt.Store(time.Now())
+	p.result.Store(pollResult{at: time.Now()})
+	notifyReady()
+	if p.churn != nil {
+		p.churn.update(collected)
+		// the target may have been removed meanwhile
+		if p.stopped() {
+			p.churn.delete()
+		}
+	}
+	if p.relays != nil || p.auth != nil {
+		stats := p.adminStats()
+		if p.relays != nil {
+			p.relays.update(collected, stats)
+			if p.stopped() {
+				p.relays.delete()
+			}
+		}
+		if p.auth != nil {
+			p.auth.update(stats)
+			if p.stopped() {
+				p.auth.delete()
+			}
+		}
+	}
+
+	for _, pub := range p.publishers {
+		pub.publish(p.url, collected)
+	}
+	return p.interval, nil
+}
+
+// adminStats loads the admin stats of the target, nil without admin
+// credentials or on errors
+func (p *poller) adminStats() *icecast.AdminStats {
+	if p.admin == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	stats, err := p.admin.Stats(ctx, p.server)
+	if err != nil {
+		if err.Error() != p.lastAdminErr {
+			log.Printf("Error loading admin stats of %s: %v", p.url, err)
+		}
+		p.lastAdminErr = err.Error()
+		return nil
+	}
+	p.lastAdminErr = ""
+	return stats
+}
+
+func updateListeners(p *poller) {
+	p.due.Store(time.Now().Add(p.offset + p.timeout))
+	go func() {
+		select {
+		case <-time.After(p.offset):
+		case <-p.done:
+			return
+		}
+
+		for {
+			p.due.Store(time.Now().Add(p.timeout))
+			delay, _ := p.poll()
+			p.due.Store(time.Now().Add(delay + p.timeout))
+			if !p.pollMounts(time.Now().Add(delay)) {
+				return
+			}
+		}
+	}()
+}
+
+// scrapeCache polls all targets when metrics are requested, reusing the last
+// result while it is younger than maxAge so multiple Prometheus servers only
+// cause a single upstream poll
+type scrapeCache struct {
+	targets *targetManager
+	maxAge  time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (c *scrapeCache) refresh() {
+	// concurrent requests wait here for the running poll and then find
+	// the cache fresh
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.last) < c.maxAge {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range c.targets.pollers() {
+		// failing targets are only retried once their backoff has passed
+		if p.retry.failures > 0 && time.Now().Before(p.retryAt) {
+			continue
+		}
+		wg.Add(1)
+		go func(p *poller) {
+			defer wg.Done()
+			p.poll()
+		}(p)
+	}
+	wg.Wait()
+	c.last = time.Now()
+}
+
+// pollAll polls every target once and returns the number of failed polls
+func pollAll(pollers []*poller) int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for _, p := range pollers {
+		wg.Add(1)
+		go func(p *poller) {
+			defer wg.Done()
+			if _, err := p.poll(); err != nil {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	return failed
+}
+
+func (c *scrapeCache) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.refresh()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+// listenerIPFunc returns the function applied to the IP of every listener
+// from the admin client list, nil keeps the IP. Hashes use a random key per
+// start of the exporter, so they cannot be linked across restarts
+func listenerIPFunc(mode string) (func(ip string) string, error) {
+	switch mode {
+	case "keep":
+		return nil, nil
+	case "truncate":
+		return icecast.TruncateIP, nil
+	case "hash":
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return icecast.HashIP(key), nil
+	case "drop":
+		return func(string) string { return "" }, nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q, must be keep, truncate, hash or drop", mode)
+	}
+}
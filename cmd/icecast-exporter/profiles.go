@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+var bitrateMismatch = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+	Name: "icecast_stream_bitrate_mismatch",
+	Help: "Whether the source of a mount deviates from the expected bitrate or codec of its profile",
+}, []string{"target", "stream_url"})
+
+// ProfileConfig is the expected encoder setting of a mount
+type ProfileConfig struct {
+	Mount string `yaml:"mount"`
+	// bitrate in kbit/s, not checked if 0
+	Bitrate float64 `yaml:"bitrate"`
+	// allowed deviation of the bitrate in kbit/s
+	Tolerance float64 `yaml:"tolerance"`
+	// format like mp3, aac or ogg, or the codec within Ogg like opus, not
+	// checked if empty
+	Codec string `yaml:"codec"`
+}
+
+// mismatch returns why a stream does not match the profile, empty if it does.
+// An unknown bitrate or content type is not a mismatch
+func (p ProfileConfig) mismatch(s collector.Stream) string {
+	var reasons []string
+	if p.Bitrate > 0 && s.Bitrate > 0 && math.Abs(s.Bitrate-p.Bitrate) > p.Tolerance {
+		reasons = append(reasons, fmt.Sprintf("bitrate %g kbit/s instead of %g", s.Bitrate, p.Bitrate))
+	}
+	format := collector.Format(s.ContentType)
+	if p.Codec != "" && format != "" && !strings.EqualFold(p.Codec, format) && !strings.EqualFold(p.Codec, s.Subtype) {
+		codec := format
+		if s.Subtype != "" {
+			codec += "/" + strings.ToLower(s.Subtype)
+		}
+		reasons = append(reasons, fmt.Sprintf("codec %s instead of %s", codec, p.Codec))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// profileChecker compares the sources of the mounts with a profile against
+// it after every poll and logs when they start or stop matching
+type profileChecker struct {
+	profiles    map[string]ProfileConfig
+	legacyLabel bool
+
+	mu sync.Mutex
+	// reason of the mismatch by target and mount
+	mismatches map[string]map[string]string
+}
+
+func newProfileChecker(configs []ProfileConfig, legacyLabel bool) (*profileChecker, error) {
+	c := &profileChecker{
+		profiles:    map[string]ProfileConfig{},
+		legacyLabel: legacyLabel,
+		mismatches:  map[string]map[string]string{},
+	}
+	for i, p := range configs {
+		p.Mount = strings.TrimPrefix(p.Mount, "/")
+		if p.Mount == "" {
+			return nil, fmt.Errorf("profile %d needs a mount", i+1)
+		}
+		if p.Bitrate <= 0 && p.Codec == "" {
+			return nil, fmt.Errorf("profile %d needs a bitrate or codec", i+1)
+		}
+		if p.Bitrate < 0 || p.Tolerance < 0 {
+			return nil, fmt.Errorf("profile %d has a negative bitrate or tolerance", i+1)
+		}
+		if _, ok := c.profiles[p.Mount]; ok {
+			return nil, fmt.Errorf("profile %d: duplicate mount %s", i+1, p.Mount)
+		}
+		c.profiles[p.Mount] = p
+	}
+	return c, nil
+}
+
+func (c *profileChecker) label(mount string) string {
+	if c.legacyLabel {
+		return collector.LegacyLabel(mount)
+	}
+	return mount
+}
+
+func (c *profileChecker) publish(target string, streams []collector.Stream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last := c.mismatches[target]
+	current := map[string]string{}
+	for _, s := range streams {
+		p, ok := c.profiles[s.Mount]
+		if !ok {
+			continue
+		}
+		reason := p.mismatch(s)
+		current[s.Mount] = reason
+
+		if prev, seen := last[s.Mount]; reason != "" && (!seen || prev != reason) {
+			log.Printf("Source of %s on %s does not match its profile: %s", s.Mount, target, reason)
+		} else if reason == "" && seen && prev != "" {
+			log.Printf("Source of %s on %s matches its profile again", s.Mount, target)
+		}
+		value := 0.0
+		if reason != "" {
+			value = 1
+		}
+		bitrateMismatch.WithLabelValues(target, c.label(s.Mount)).Set(value)
+	}
+	// disconnected sources neither match nor mismatch
+	for mount := range last {
+		if _, ok := current[mount]; !ok {
+			bitrateMismatch.DeleteLabelValues(target, c.label(mount))
+		}
+	}
+	c.mismatches[target] = current
+}
+
+func (c *profileChecker) forget(target string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for mount := range c.mismatches[target] {
+		bitrateMismatch.DeleteLabelValues(target, c.label(mount))
+	}
+	delete(c.mismatches, target)
+}
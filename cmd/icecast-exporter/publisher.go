@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+// streamPublisher is notified with the collected streams of a target after
+// every successful poll, the streams are used as data of the templates
+type streamPublisher interface {
+	publish(target string, streams []collector.Stream)
+}
+
+// targetForgetter is implemented by publishers keeping state per target, it
+// is called when a target is removed by service discovery
+type targetForgetter interface {
+	forget(target string)
+}
+
+// pollFailureObserver is implemented by publishers which count failed polls,
+// the streams of the target are unknown then
+type pollFailureObserver interface {
+	pollFailed(target string)
+}
+
+// pollCounter is implemented by publishers which count polls of a target,
+// the mounts polled on their own in between are passed to publishMount so
+// only the polled mount is counted again
+type pollCounter interface {
+	publishMount(target, mount string, streams []collector.Stream)
+}
+
+func executeTemplate(t *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+type pushOptions struct {
+	url      string
+	job      string
+	grouping map[string]string
+	username string
+	password string
+}
+
+// pushMetrics periodically pushes all metrics to a Pushgateway, replacing the
+// metrics of the previous push for the same grouping key
+func pushMetrics(opts pushOptions, interval time.Duration, refresh func()) {
+	pusher := push.New(opts.url, opts.job).Gatherer(withoutTimestamps(reg))
+	for name, value := range opts.grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	if opts.username != "" {
+		pusher = pusher.BasicAuth(opts.username, opts.password)
+	}
+
+	runOutput("Pushgateway", interval, refresh, pusher.Push)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+var (
+	relayUp = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "icecast_relay_up",
+		Help: "Whether a relayed mount of a target is connected to its master",
+	}, []string{"target", "stream_url"})
+	relaysConnected = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "icecast_relays_connected",
+		Help: "Number of relayed mounts of a target connected to their master",
+	}, []string{"target"})
+	relayConnections = newServerCounters("icecast_source_relay_connections_total",
+		"Total number of connections of relays to their masters since the Icecast server started, from the admin stats")
+)
+
+// relayStatus tracks the relayed mounts of a target. Icecast does not mark
+// relayed sources in its stats, so they are configured per target and count
+// as connected while their mount is present
+type relayStatus struct {
+	target      string
+	mounts      []string
+	legacyLabel bool
+
+	mu sync.Mutex
+}
+
+func newRelayStatus(target string, mounts []string, legacyLabel bool) *relayStatus {
+	r := &relayStatus{
+		target:      target,
+		legacyLabel: legacyLabel,
+	}
+	for _, m := range mounts {
+		r.mounts = append(r.mounts, strings.TrimPrefix(m, "/"))
+	}
+	return r
+}
+
+func (r *relayStatus) label(mount string) string {
+	if r.legacyLabel {
+		return collector.LegacyLabel(mount)
+	}
+	return mount
+}
+
+// update sets the relay metrics, the relay connections only if admin stats
+// were loaded
+func (r *relayStatus) update(streams []collector.Stream, stats *icecast.AdminStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	present := map[string]bool{}
+	for _, s := range streams {
+		present[s.Mount] = true
+	}
+	connected := 0
+	for _, m := range r.mounts {
+		value := 0.0
+		if present[m] {
+			value = 1
+			connected++
+		}
+		relayUp.WithLabelValues(r.target, r.label(m)).Set(value)
+	}
+	relaysConnected.WithLabelValues(r.target).Set(float64(connected))
+
+	if stats != nil {
+		relayConnections.set(float64(stats.SourceRelayConnections), r.target)
+	}
+}
+
+// delete removes the metrics of the target
+func (r *relayStatus) delete() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range r.mounts {
+		relayUp.DeleteLabelValues(r.target, r.label(m))
+	}
+	relaysConnected.DeleteLabelValues(r.target)
+	relayConnections.deleteTarget(r.target)
+}
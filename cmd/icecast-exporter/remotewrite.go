@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type remoteWriteOptions struct {
+	url            string
+	externalLabels map[string]string
+	bearerToken    string
+	username       string
+	password       string
+}
+
+var remoteWriteClient = &http.Client{Timeout: 30 * time.Second}
+
+// encodeWriteRequest encodes samples as a prometheus.WriteRequest protobuf
+// message, see https://prometheus.io/docs/concepts/remote_write_spec/
+func encodeWriteRequest(samples []sample, externalLabels map[string]string, timestamp int64) []byte {
+	var req []byte
+	for _, s := range samples {
+		labels := map[string]string{"__name__": s.name}
+		for name, value := range externalLabels {
+			labels[name] = value
+		}
+		// labels of the metric take precedence over external labels
+		for _, l := range s.labels {
+			labels[l.GetName()] = l.GetValue()
+		}
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var ts []byte
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, labels[name])
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		var value []byte
+		value = protowire.AppendTag(value, 1, protowire.Fixed64Type)
+		value = protowire.AppendFixed64(value, math.Float64bits(s.value))
+		value = protowire.AppendTag(value, 2, protowire.VarintType)
+		value = protowire.AppendVarint(value, uint64(timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, value)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+func (o remoteWriteOptions) write() error {
+	samples, err := gatherSamples(reg)
+	if err != nil {
+		return err
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(samples, o.externalLabels, time.Now().UnixMilli()))
+
+	req, err := http.NewRequest(http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "icecast-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if o.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+o.bearerToken)
+	} else if o.username != "" {
+		req.SetBasicAuth(o.username, o.password)
+	}
+
+	resp, err := remoteWriteClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("unexpected HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// remoteWrite periodically sends all metrics to a Prometheus remote_write
+// endpoint
+func remoteWrite(opts remoteWriteOptions, interval time.Duration, refresh func()) {
+	runOutput("remote_write", interval, refresh, opts.write)
+}
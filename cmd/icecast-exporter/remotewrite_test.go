@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type decodedSeries struct {
+	labels    [][2]string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest parses the fields of a WriteRequest written by
+// encodeWriteRequest
+func decodeWriteRequest(t *testing.T, b []byte) []decodedSeries {
+	t.Helper()
+	var series []decodedSeries
+	for len(b) > 0 {
+		ts := consumeBytes(t, &b, 1)
+		var s decodedSeries
+		for len(ts) > 0 {
+			num, typ, n := protowire.ConsumeTag(ts)
+			if n < 0 || typ != protowire.BytesType {
+				t.Fatalf("unexpected field %d of type %d in time series", num, typ)
+			}
+			ts = ts[n:]
+			field, n := protowire.ConsumeBytes(ts)
+			if n < 0 {
+				t.Fatal("truncated time series field")
+			}
+			ts = ts[n:]
+			switch num {
+			case 1:
+				name := consumeBytes(t, &field, 1)
+				value := consumeBytes(t, &field, 2)
+				s.labels = append(s.labels, [2]string{string(name), string(value)})
+			case 2:
+				_, _, n := protowire.ConsumeTag(field)
+				bits, m := protowire.ConsumeFixed64(field[n:])
+				field = field[n+m:]
+				_, _, n = protowire.ConsumeTag(field)
+				timestamp, _ := protowire.ConsumeVarint(field[n:])
+				s.value = math.Float64frombits(bits)
+				s.timestamp = int64(timestamp)
+			}
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+func consumeBytes(t *testing.T, b *[]byte, want protowire.Number) []byte {
+	t.Helper()
+	num, typ, n := protowire.ConsumeTag(*b)
+	if n < 0 || num != want || typ != protowire.BytesType {
+		t.Fatalf("expected bytes field %d, got field %d of type %d", want, num, typ)
+	}
+	v, m := protowire.ConsumeBytes((*b)[n:])
+	if m < 0 {
+		t.Fatalf("truncated field %d", want)
+	}
+	*b = (*b)[n+m:]
+	return v
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		samples        []sample
+		externalLabels map[string]string
+		want           []decodedSeries
+	}{
+		{"no samples", nil, nil, nil},
+		{
+			"labels sorted with the name",
+			[]sample{listenerSample("Radio", "live.mp3", 12)},
+			nil,
+			[]decodedSeries{{
+				labels:    [][2]string{{"__name__", "icecast_listeners"}, {"server_name", "Radio"}, {"stream_url", "live.mp3"}},
+				value:     12,
+				timestamp: 1700000000000,
+			}},
+		},
+		{
+			"labels of the metric win over external labels",
+			[]sample{listenerSample("Radio", "live.mp3", 1.5)},
+			map[string]string{"instance": "relay1", "server_name": "external"},
+			[]decodedSeries{{
+				labels:    [][2]string{{"__name__", "icecast_listeners"}, {"instance", "relay1"}, {"server_name", "Radio"}, {"stream_url", "live.mp3"}},
+				value:     1.5,
+				timestamp: 1700000000000,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decodeWriteRequest(t, encodeWriteRequest(tt.samples, tt.externalLabels, 1700000000000))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("encodeWriteRequest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sample is a single value of a gathered metric, histograms and summaries are
+// flattened into their _bucket, _sum and _count series like in the text format
+type sample struct {
+	name   string
+	labels []*dto.LabelPair
+	value  float64
+	typ    dto.MetricType
+}
+
+func labelPair(name string, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: &name, Value: &value}
+}
+
+// withLabel returns a copy of labels with an additional label, sorted by name
+func withLabel(labels []*dto.LabelPair, name string, value string) []*dto.LabelPair {
+	l := append(append([]*dto.LabelPair{}, labels...), labelPair(name, value))
+	sort.Slice(l, func(i, j int) bool { return l[i].GetName() < l[j].GetName() })
+	return l
+}
+
+func formatFloat(f float64) string {
+	return fmt.Sprint(f)
+}
+
+// gatherSamples collects all metrics of g as a flat list of samples
+func gatherSamples(g prometheus.Gatherer) ([]sample, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []sample
+	for _, mf := range families {
+		name := mf.GetName()
+		typ := mf.GetType()
+		for _, m := range mf.GetMetric() {
+			labels := m.GetLabel()
+			switch typ {
+			case dto.MetricType_COUNTER:
+				samples = append(samples, sample{name, labels, m.GetCounter().GetValue(), typ})
+			case dto.MetricType_GAUGE:
+				samples = append(samples, sample{name, labels, m.GetGauge().GetValue(), typ})
+			case dto.MetricType_UNTYPED:
+				samples = append(samples, sample{name, labels, m.GetUntyped().GetValue(), typ})
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					samples = append(samples, sample{name, withLabel(labels, "quantile", formatFloat(q.GetQuantile())), q.GetValue(), typ})
+				}
+				samples = append(samples,
+					sample{name + "_sum", labels, s.GetSampleSum(), typ},
+					sample{name + "_count", labels, float64(s.GetSampleCount()), typ})
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					samples = append(samples, sample{name + "_bucket", withLabel(labels, "le", formatFloat(b.GetUpperBound())), float64(b.GetCumulativeCount()), typ})
+				}
+				samples = append(samples,
+					sample{name + "_bucket", withLabel(labels, "le", formatFloat(math.Inf(1))), float64(h.GetSampleCount()), typ},
+					sample{name + "_sum", labels, h.GetSampleSum(), typ},
+					sample{name + "_count", labels, float64(h.GetSampleCount()), typ})
+			}
+		}
+	}
+	return samples, nil
+}
+
+var invalidPathChars = regexp.MustCompile(`[^a-zA-Z0-9_\-]`)
+
+// pathElement makes s usable as a single element of a dot separated metric
+// path (StatsD, Graphite)
+func pathElement(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return invalidPathChars.ReplaceAllString(s, "_")
+}
+
+// metricPath builds prefix.<label values>.<name> with the icecast_ prefix of
+// the metric name removed, e.g. icecast.Example_Radio.live_mp3.listeners
+func metricPath(prefix string, s sample, withLabels bool) string {
+	elements := []string{}
+	if prefix != "" {
+		elements = append(elements, prefix)
+	}
+	if withLabels {
+		for _, l := range s.labels {
+			elements = append(elements, pathElement(l.GetValue()))
+		}
+	}
+	elements = append(elements, pathElement(strings.TrimPrefix(s.name, "icecast_")))
+	return strings.Join(elements, ".")
+}
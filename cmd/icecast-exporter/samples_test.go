@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// listenerSample returns an icecast_listeners sample as gathered from the registry
+func listenerSample(serverName, streamURL string, value float64) sample {
+	return sample{
+		name:   "icecast_listeners",
+		labels: []*dto.LabelPair{labelPair("server_name", serverName), labelPair("stream_url", streamURL)},
+		value:  value,
+		typ:    dto.MetricType_GAUGE,
+	}
+}
+
+func TestMetricPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefix     string
+		sample     sample
+		withLabels bool
+		want       string
+	}{
+		{"labels", "icecast", listenerSample("Example Radio", "live.mp3", 12), true, "icecast.Example_Radio.live_mp3.listeners"},
+		{"without labels", "icecast", listenerSample("Example Radio", "live.mp3", 12), false, "icecast.listeners"},
+		{"without prefix", "", listenerSample("Radio", "live.mp3", 12), true, "Radio.live_mp3.listeners"},
+		{"empty label value", "icecast", listenerSample("", "live.mp3", 12), true, "icecast._.live_mp3.listeners"},
+		{"other prefix", "radio", sample{name: "go_info", value: 1}, true, "radio.go_info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metricPath(tt.prefix, tt.sample, tt.withLabels); got != tt.want {
+				t.Errorf("metricPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sdNotify sends a state like READY=1 to systemd, it does nothing when not
+// started by systemd with Type=notify
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// abstract socket
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+var readyOnce sync.Once
+
+// notifyReady tells systemd the exporter is ready, called after every
+// successful poll
+func notifyReady() {
+	readyOnce.Do(func() {
+		if err := sdNotify("READY=1"); err != nil {
+			log.Println("Error notifying systemd:", err)
+		}
+	})
+}
+
+// watchdogInterval returns the interval of the systemd watchdog, 0 if it is
+// not enabled for this process
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// healthy reports whether the poll loops make progress: every poller must
+// have finished its last poll in time, allowing for the wait for a slot
+func (m *targetManager) healthy() bool {
+	pollers := m.pollers()
+	if !m.background {
+		return true
+	}
+	slots := cap(m.template.slots)
+	now := time.Now()
+	for _, p := range pollers {
+		due, ok := p.due.Load().(time.Time)
+		if !ok {
+			continue
+		}
+		wait := p.timeout * time.Duration((len(pollers)+slots-1)/slots)
+		if now.After(due.Add(wait)) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchdog pings the systemd watchdog at half its interval while the target
+// manager is healthy, so a wedged exporter is restarted
+func watchdog(targets *targetManager) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	log.Println("notify the systemd watchdog every", interval/2)
+	go func() {
+		for {
+			time.Sleep(interval / 2)
+			if !targets.healthy() {
+				log.Println("Polls are stuck, stop notifying the systemd watchdog")
+				continue
+			}
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				log.Println("Error notifying systemd:", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// serverCounters exports counters kept by the Icecast servers, which cannot
+// be set on a prometheus.Counter. The first label is the target
+type serverCounters struct {
+	desc *prometheus.Desc
+
+	mu     sync.Mutex
+	values map[string]serverCounter
+}
+
+type serverCounter struct {
+	labelValues []string
+	value       float64
+}
+
+func newServerCounters(name, help string, labels ...string) *serverCounters {
+	c := &serverCounters{
+		desc:   prometheus.NewDesc(name, help, append([]string{"target"}, labels...), nil),
+		values: map[string]serverCounter{},
+	}
+	reg.MustRegister(c)
+	return c
+}
+
+func (c *serverCounters) set(value float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(labelValues, "\xff")] = serverCounter{labelValues: labelValues, value: value}
+}
+
+func (c *serverCounters) delete(labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, strings.Join(labelValues, "\xff"))
+}
+
+// deleteTarget removes all counters of a target
+func (c *serverCounters) deleteTarget(target string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, v := range c.values {
+		if v.labelValues[0] == target {
+			delete(c.values, key)
+		}
+	}
+}
+
+func (c *serverCounters) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *serverCounters) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, v := range c.values {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, v.value, v.labelValues...)
+	}
+}
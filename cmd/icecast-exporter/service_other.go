@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import "github.com/alecthomas/kingpin/v2"
+
+// runService runs the exporter as Windows service, there is none elsewhere
+func runService() bool {
+	return false
+}
+
+// serviceCommands registers the commands managing the Windows service, there
+// are none elsewhere
+func serviceCommands(app *kingpin.Application) func(command string) bool {
+	return func(command string) bool { return false }
+}
@@ -0,0 +1,215 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "icecast-exporter"
+
+// windowsService runs the exporter until the service manager stops it
+type windowsService struct{}
+
+func (windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	go run()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for r := range requests {
+		switch r.Cmd {
+		case svc.Interrogate:
+			status <- r.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			log.Println("Stopping Icecast Exporter")
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// eventLogWriter writes the log lines to the Windows event log, lines
+// starting with Error as errors
+type eventLogWriter struct {
+	log *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	var err error
+	if strings.HasPrefix(msg, "Error") {
+		err = w.log.Error(1, msg)
+	} else {
+		err = w.log.Info(1, msg)
+	}
+	return len(p), err
+}
+
+// runService runs the exporter as Windows service if it was started by the
+// service manager, logging to the event log
+func runService() bool {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false
+	}
+
+	elog, err := eventlog.Open(serviceName)
+	if err == nil {
+		defer elog.Close()
+		// the event log has its own timestamps
+		log.SetFlags(0)
+		log.SetOutput(eventLogWriter{elog})
+	}
+	if err := svc.Run(serviceName, windowsService{}); err != nil {
+		log.Println("Error running service:", err)
+	}
+	return true
+}
+
+// serviceCommands registers the commands managing the Windows service, the
+// returned function runs them and reports whether command was one of them
+func serviceCommands(app *kingpin.Application) func(command string) bool {
+	serviceCmd := app.Command("service", "manage the Windows service of the exporter")
+	installCmd := serviceCmd.Command("install", "install the Windows service, the other flags are passed to the service")
+	uninstallCmd := serviceCmd.Command("uninstall", "remove the Windows service")
+	startCmd := serviceCmd.Command("start", "start the Windows service")
+	stopCmd := serviceCmd.Command("stop", "stop the Windows service")
+
+	return func(command string) bool {
+		var err error
+		switch command {
+		case installCmd.FullCommand():
+			err = installService(serviceArgs(os.Args[1:]))
+		case uninstallCmd.FullCommand():
+			err = uninstallService()
+		case startCmd.FullCommand():
+			err = controlService(func(s *mgr.Service) error { return s.Start() })
+		case stopCmd.FullCommand():
+			err = controlService(func(s *mgr.Service) error {
+				_, err := s.Control(svc.Stop)
+				return err
+			})
+		default:
+			return false
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return true
+	}
+}
+
+// serviceArgs returns the command line without the service install command
+func serviceArgs(args []string) []string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "service" && args[i+1] == "install" {
+			return append(append([]string{}, args[:i]...), args[i+2:]...)
+		}
+	}
+	return args
+}
+
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Icecast Exporter",
+		Description: "Exports statistics from Icecast into Prometheus",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("error installing event log source: %w", err)
+	}
+	fmt.Println("installed service", serviceName)
+	return nil
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	if err := eventlog.Remove(serviceName); err != nil {
+		return fmt.Errorf("error removing event log source: %w", err)
+	}
+	fmt.Println("removed service", serviceName)
+	return nil
+}
+
+func controlService(control func(s *mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	if err := control(s); err != nil {
+		return err
+	}
+	// give the service manager a moment so the state is current
+	time.Sleep(time.Second)
+	status, err := s.Query()
+	if err != nil {
+		return err
+	}
+	fmt.Println("service", serviceName, serviceState(status.State))
+	return nil
+}
+
+func serviceState(state svc.State) string {
+	switch state {
+	case svc.Stopped:
+		return "stopped"
+	case svc.StartPending:
+		return "starting"
+	case svc.StopPending:
+		return "stopping"
+	case svc.Running:
+		return "running"
+	default:
+		return fmt.Sprintf("in state %d", state)
+	}
+}
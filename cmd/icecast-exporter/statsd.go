@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+type statsdOptions struct {
+	address   string
+	prefix    string
+	dogstatsd bool
+}
+
+// maximum payload of a single UDP packet that is safe on most networks
+const statsdMaxPacket = 1432
+
+var dogstatsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_")
+
+func (o statsdOptions) line(s sample) string {
+	// plain StatsD has no tags, label values become part of the name instead
+	line := fmt.Sprintf("%s:%g|g", metricPath(o.prefix, s, !o.dogstatsd), s.value)
+	if o.dogstatsd && len(s.labels) > 0 {
+		tags := make([]string, 0, len(s.labels))
+		for _, l := range s.labels {
+			tags = append(tags, dogstatsdTagReplacer.Replace(l.GetName()+":"+l.GetValue()))
+		}
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// send writes all metrics as gauges, counters are sent with their total value
+// since the exporter only knows cumulative values
+func (o statsdOptions) send() error {
+	samples, err := gatherSamples(reg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.Dial("udp", o.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, s := range samples {
+		line := o.line(s)
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacket {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
+
+// sendStatsd periodically sends all metrics as StatsD gauges
+func sendStatsd(opts statsdOptions, interval time.Duration, refresh func()) {
+	runOutput("StatsD", interval, refresh, opts.send)
+}
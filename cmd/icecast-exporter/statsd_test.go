@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestStatsdLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   statsdOptions
+		sample sample
+		want   string
+	}{
+		{
+			"plain",
+			statsdOptions{prefix: "icecast"},
+			listenerSample("Example Radio", "live.mp3", 12),
+			"icecast.Example_Radio.live_mp3.listeners:12|g",
+		},
+		{
+			"dogstatsd tags",
+			statsdOptions{prefix: "icecast", dogstatsd: true},
+			listenerSample("Example Radio", "live.mp3", 12),
+			"icecast.listeners:12|g|#server_name:Example Radio,stream_url:live.mp3",
+		},
+		{
+			"dogstatsd tag separators replaced",
+			statsdOptions{prefix: "icecast", dogstatsd: true},
+			listenerSample("a,b|c#d", "live.mp3", 1),
+			"icecast.listeners:1|g|#server_name:a_b_c_d,stream_url:live.mp3",
+		},
+		{
+			"dogstatsd without labels",
+			statsdOptions{prefix: "icecast", dogstatsd: true},
+			sample{name: "icecast_liquidsoap_up", value: 1, typ: dto.MetricType_GAUGE},
+			"icecast.liquidsoap_up:1|g",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.line(tt.sample); got != tt.want {
+				t.Errorf("line() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
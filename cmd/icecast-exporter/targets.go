@@ -0,0 +1,203 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+var discoveredTargets = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+	Name: "icecast_discovered_targets",
+	Help: "Number of Icecast targets provided by the config file or a service discovery",
+}, []string{"provider"})
+
+// targetManager runs a poller per target, the targets are provided by the
+// config file and service discovery and identified by their URL
+type targetManager struct {
+	// template of all pollers, the options of the target are set per poller
+	template poller
+	// defaults of unset target options
+	defaults   TargetConfig
+	transports *transportPool
+	// applied to the listener IPs of the admin client lists, nil keeps them
+	listenerIP  func(ip string) string
+	legacyLabel bool
+	maxBackoff  time.Duration
+	// start the poll loops, false when polling on demand
+	background bool
+
+	mu sync.Mutex
+	// providers in order of registration, the first provider of a URL wins
+	order     []string
+	providers map[string][]TargetConfig
+	running   map[string]*poller
+	configs   map[string]TargetConfig
+}
+
+func newTargetManager(template poller, defaults TargetConfig, transports *transportPool, listenerIP func(ip string) string, legacyLabel bool, maxBackoff time.Duration, background bool) *targetManager {
+	return &targetManager{
+		template:    template,
+		defaults:    defaults,
+		transports:  transports,
+		listenerIP:  listenerIP,
+		legacyLabel: legacyLabel,
+		maxBackoff:  maxBackoff,
+		background:  background,
+		providers:   map[string][]TargetConfig{},
+		running:     map[string]*poller{},
+		configs:     map[string]TargetConfig{},
+	}
+}
+
+// sync replaces the targets of a provider, starting pollers for new targets
+// and stopping those of removed ones
+func (m *targetManager) sync(provider string, targets []TargetConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.providers[provider]; !ok {
+		m.order = append(m.order, provider)
+	}
+	m.providers[provider] = targets
+	discoveredTargets.WithLabelValues(provider).Set(float64(len(targets)))
+
+	desired := map[string]TargetConfig{}
+	for _, name := range m.order {
+		for _, t := range m.providers[name] {
+			if _, ok := desired[t.URL]; !ok {
+				desired[t.URL] = t
+			}
+		}
+	}
+
+	for url, p := range m.running {
+		if t, ok := desired[url]; !ok || !reflect.DeepEqual(t, m.configs[url]) {
+			log.Println("stop polling", url)
+			p.stop()
+			for _, pub := range p.publishers {
+				if f, ok := pub.(targetForgetter); ok {
+					f.forget(url)
+				}
+			}
+			delete(m.running, url)
+			delete(m.configs, url)
+		}
+	}
+
+	var added []TargetConfig
+	for url, t := range desired {
+		if _, ok := m.running[url]; !ok {
+			added = append(added, t)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].URL < added[j].URL })
+
+	for i, t := range added {
+		c := t.withDefaults(m.defaults)
+		client, err := m.transports.client(c)
+		if err != nil {
+			log.Printf("Error configuring target %s: %v", t.URL, err)
+			continue
+		}
+
+		p := m.template
+		p.url = t.URL
+		p.labels = t.Labels
+		p.cluster = t.Cluster
+		p.serverName = c.Filter
+		p.interval = c.Interval
+		p.mounts = trimMountPatterns(c.Mounts)
+		for _, mount := range p.mounts {
+			if err = mount.validate(c.Interval); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			log.Printf("Error configuring target %s: %v", t.URL, err)
+			continue
+		}
+		p.timeout = c.Timeout
+		p.client = client
+		// admin requests use a copy of the client with the admin credentials
+		var admin *icecast.Client
+		if c.AdminPassword != "" {
+			admin = new(icecast.Client)
+			*admin = *client
+			admin.Username, admin.Password = c.AdminUsername, c.AdminPassword
+			admin.ListenerIP = m.listenerIP
+			if p.churn, err = newListenerChurn(t.URL, admin, c.Timeout, m.legacyLabel); err != nil {
+				log.Printf("Error configuring target %s: %v", t.URL, err)
+				continue
+			}
+		}
+		if len(c.Relays) > 0 {
+			p.relays = newRelayStatus(t.URL, c.Relays, m.legacyLabel)
+		}
+		if admin != nil && (c.AuthStats.Success != "" || c.AuthStats.Failures != "") {
+			p.auth = newAuthCounters(t.URL, c.AuthStats, m.legacyLabel)
+		}
+		if admin != nil && (p.relays != nil || p.auth != nil) {
+			p.admin = admin
+			if p.server, err = icecast.ServerURL(t.URL); err != nil {
+				log.Printf("Error configuring target %s: %v", t.URL, err)
+				continue
+			}
+		}
+		// spread the first polls of the new targets evenly across their
+		// interval with the first target starting immediately
+		p.offset = c.Interval * time.Duration(i) / time.Duration(len(added))
+
+		started := newPoller(p, m.maxBackoff)
+		if started.keepResponse {
+			started.client.OnStatusResponse = func(r icecast.Response) { started.lastResponse.Store(r) }
+		}
+		m.running[t.URL] = started
+		m.configs[t.URL] = t
+		if m.background {
+			updateListeners(started)
+		}
+	}
+}
+
+// streams returns the streams of the last poll of every target, sorted by URL
+func (m *targetManager) streams() []collector.TargetStreams {
+	var streams []collector.TargetStreams
+	for _, p := range m.pollers() {
+		streams = append(streams, collector.TargetStreams{Labels: p.labels, Streams: p.lastStreams(), PolledAt: p.lastPoll()})
+	}
+	return streams
+}
+
+// provider returns the first provider of a target, empty if it is unknown
+func (m *targetManager) provider(url string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.order {
+		for _, t := range m.providers[name] {
+			if t.URL == url {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// pollers returns the running pollers sorted by URL
+func (m *targetManager) pollers() []*poller {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pollers := make([]*poller, 0, len(m.running))
+	for _, p := range m.running {
+		pollers = append(pollers, p)
+	}
+	sort.Slice(pollers, func(i, j int) bool { return pollers[i].url < pollers[j].url })
+	return pollers
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// writeTextfile periodically writes all metrics to path for the textfile
+// collector of node_exporter
+func writeTextfile(path string, interval time.Duration, refresh func()) {
+	if filepath.Ext(path) != ".prom" {
+		log.Printf("textfile %s does not end in .prom and will be ignored by node_exporter", path)
+	}
+
+	// WriteToTextfile writes to a temporary file and renames it, so
+	// node_exporter never reads a partial file
+	runOutput("textfile", interval, refresh, func() error {
+		return prometheus.WriteToTextfile(path, withoutTimestamps(reg))
+	})
+}
+
+// withoutTimestamps drops the timestamps of --web.sample-timestamps, the
+// textfile collector and the Pushgateway reject samples carrying one
+func withoutTimestamps(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		for _, mf := range families {
+			for _, m := range mf.Metric {
+				m.TimestampMs = nil
+			}
+		}
+		return families, err
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+func TestWithoutTimestamps(t *testing.T) {
+	streams := []collector.TargetStreams{{
+		Streams:  []collector.Stream{{ServerName: "Radio", Mount: "live.mp3", Listeners: 3}},
+		PolledAt: time.Now(),
+	}}
+	g := prometheus.NewRegistry()
+	g.MustRegister(collector.NewListenerCollector(func() []collector.TargetStreams { return streams }, collector.Options{Timestamps: true}))
+
+	count := func(g prometheus.Gatherer) (series, timestamps int) {
+		families, err := g.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mf := range families {
+			for _, m := range mf.GetMetric() {
+				series++
+				if m.TimestampMs != nil {
+					timestamps++
+				}
+			}
+		}
+		return series, timestamps
+	}
+
+	if series, timestamps := count(g); series == 0 || timestamps != series {
+		t.Fatalf("%d of %d series with timestamps before, want all", timestamps, series)
+	}
+	if series, timestamps := count(withoutTimestamps(g)); series == 0 || timestamps != 0 {
+		t.Errorf("%d of %d series with timestamps, want none", timestamps, series)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+// transportPool shares a transport between all targets with the same TLS
+// options and unix socket, so connections are kept alive across polls and
+// targets on the same server instead of a new handshake per poll
+type transportPool struct {
+	// time idle connections are kept, longer than the poll interval to be reused
+	idleTimeout time.Duration
+	http2       bool
+
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func newTransportPool(idleTimeout time.Duration, http2 bool) *transportPool {
+	return &transportPool{
+		idleTimeout: idleTimeout,
+		http2:       http2,
+		transports:  map[string]*http.Transport{},
+	}
+}
+
+func (c TLSConfig) key() string {
+	insecure := c.InsecureSkipVerify != nil && *c.InsecureSkipVerify
+	return fmt.Sprintf("%q %q %q %q %t", c.CAFile, c.CertFile, c.KeyFile, c.ServerName, insecure)
+}
+
+func (p *transportPool) transport(c TLSConfig, unixSocket string) (*http.Transport, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := c.key() + " " + unixSocket
+	if t, ok := p.transports[key]; ok {
+		return t, nil
+	}
+	tlsConfig, err := c.config()
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	t.MaxIdleConns = 100
+	// a poll and the admin requests of a target may run at the same time
+	t.MaxIdleConnsPerHost = 4
+	t.IdleConnTimeout = p.idleTimeout
+	if !p.http2 {
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if unixSocket != "" {
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", unixSocket)
+		}
+		// a proxy would be dialed over the socket as well
+		t.Proxy = nil
+	}
+	p.transports[key] = t
+	return t, nil
+}
+
+// client returns the Icecast client of a target with its auth and TLS options
+func (p *transportPool) client(t TargetConfig) (*icecast.Client, error) {
+	transport, err := p.transport(t.TLS, t.UnixSocket)
+	if err != nil {
+		return nil, err
+	}
+	return &icecast.Client{
+		HTTPClient: &http.Client{Transport: transport},
+		Username:   t.Username,
+		Password:   t.Password,
+	}, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+var vclockErrors = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+	Name: "icecast_vclock_publish_errors_total",
+	Help: "Total number of failed publishes to a VClock, after all retries",
+}, []string{"clock"})
+
+const (
+	aggregateSum    = "sum"
+	aggregateMax    = "max"
+	aggregateStream = "stream"
+)
+
+// ClockConfig maps a VClock to the streams it shows, without mount and
+// server_name it shows all collected streams
+type ClockConfig struct {
+	Address    string `yaml:"address"`
+	Aggregate  string `yaml:"aggregate"`
+	Mount      string `yaml:"mount"`
+	ServerName string `yaml:"server_name"`
+	// minimum time between two publishes, defaults to --vclock.min-interval
+	MinInterval time.Duration `yaml:"min_interval"`
+}
+
+// vclockOptions are shared by all VClocks
+type vclockOptions struct {
+	timeout     time.Duration
+	retries     int
+	minInterval time.Duration
+}
+
+// vclockPublisher shows the listeners of the selected streams on a VClock,
+// aggregated over all targets
+type vclockPublisher struct {
+	clock      string
+	aggregate  string
+	mount      string
+	serverName string
+
+	client      *http.Client
+	retries     int
+	minInterval time.Duration
+
+	mu sync.Mutex
+	// streams of the last poll per target
+	streams     map[string][]collector.Stream
+	lastPublish time.Time
+	// a publish including its retries is running
+	sending bool
+	failing bool
+}
+
+func newVClockPublisher(c ClockConfig, opts vclockOptions) (*vclockPublisher, error) {
+	if c.Address == "" {
+		return nil, fmt.Errorf("missing address")
+	}
+	aggregate := c.Aggregate
+	switch aggregate {
+	case "":
+		aggregate = aggregateSum
+	case aggregateSum, aggregateMax:
+	case aggregateStream:
+		// a single selected stream, kept for --vclock.aggregate stream
+		if c.Mount == "" && c.ServerName == "" {
+			return nil, fmt.Errorf("aggregate %s needs a mount or server_name", aggregate)
+		}
+		aggregate = aggregateSum
+	default:
+		return nil, fmt.Errorf("unknown aggregate %q, must be sum, max or stream", aggregate)
+	}
+	minInterval := c.MinInterval
+	if minInterval == 0 {
+		minInterval = opts.minInterval
+	}
+
+	vclockErrors.WithLabelValues(c.Address)
+
+	return &vclockPublisher{
+		clock:       c.Address,
+		aggregate:   aggregate,
+		mount:       strings.TrimPrefix(c.Mount, "/"),
+		serverName:  c.ServerName,
+		client:      &http.Client{Timeout: opts.timeout},
+		retries:     opts.retries,
+		minInterval: minInterval,
+		streams:     map[string][]collector.Stream{},
+	}, nil
+}
+
+func (v *vclockPublisher) selects(s collector.Stream) bool {
+	return (v.mount == "" || s.Mount == v.mount) && (v.serverName == "" || s.ServerName == v.serverName)
+}
+
+// value returns the listeners to show, ok is false if a selected stream was
+// not collected
+func (v *vclockPublisher) value() (listeners int, ok bool) {
+	found := false
+	for _, streams := range v.streams {
+		for _, s := range streams {
+			if !v.selects(s) {
+				continue
+			}
+			switch v.aggregate {
+			case aggregateSum:
+				listeners += s.Listeners
+			case aggregateMax:
+				if !found || s.Listeners > listeners {
+					listeners = s.Listeners
+				}
+			}
+			found = true
+		}
+	}
+	// without selection the clock shows 0 if no stream is connected
+	return listeners, found || (v.mount == "" && v.serverName == "")
+}
+
+func (v *vclockPublisher) publish(target string, streams []collector.Stream) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.streams[target] = streams
+	listeners, ok := v.value()
+	// skip while the previous publish is still retrying or too recent, the
+	// next poll publishes the current value anyway
+	if !ok || v.sending || time.Since(v.lastPublish) < v.minInterval {
+		return
+	}
+	v.sending = true
+	v.lastPublish = time.Now()
+
+	go v.publishWithRetries(listeners)
+}
+
+func (v *vclockPublisher) forget(target string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.streams, target)
+}
+
+func (v *vclockPublisher) publishWithRetries(listeners int) {
+	retry := newBackoff(time.Second, 10*time.Second)
+	err := v.send(listeners)
+	for attempt := 0; err != nil && attempt < v.retries; attempt++ {
+		time.Sleep(retry.fail())
+		err = v.send(listeners)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sending = false
+
+	if err != nil {
+		vclockErrors.WithLabelValues(v.clock).Inc()
+		if !v.failing {
+			log.Printf("Error publishing to VClock %s: %v", v.clock, err)
+		}
+		v.failing = true
+	} else if v.failing {
+		log.Printf("VClock %s recovered", v.clock)
+		v.failing = false
+	}
+}
+
+func (v *vclockPublisher) send(listeners int) error {
+	s := fmt.Sprintf("http://%s/?Command=SetMem=Listeners,%d", v.clock, listeners)
+
+	resp, err := v.client.Get(s)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return nil
+}
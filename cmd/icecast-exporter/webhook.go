@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/zecktos/icecast-exporter/pkg/collector"
+)
+
+// PublisherConfig configures an HTTP request sent for every collected stream,
+// url and body are Go templates executed with the stream
+type PublisherConfig struct {
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	// minimum time between two requests for the same stream
+	Interval time.Duration `yaml:"interval"`
+}
+
+var (
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+	templateFuncs = template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}
+)
+
+type webhookPublisher struct {
+	method   string
+	url      *template.Template
+	body     *template.Template
+	headers  map[string]string
+	interval time.Duration
+
+	mu sync.Mutex
+	// time of the last request per target by listen url
+	lastSent map[string]map[string]time.Time
+}
+
+func newWebhookPublisher(c PublisherConfig) (*webhookPublisher, error) {
+	url, err := template.New("url").Funcs(templateFuncs).Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url template: %w", err)
+	}
+	body, err := template.New("body").Funcs(templateFuncs).Parse(c.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+
+	method := strings.ToUpper(c.Method)
+	if method == "" {
+		method = http.MethodGet
+		if c.Body != "" {
+			method = http.MethodPost
+		}
+	}
+
+	return &webhookPublisher{
+		method:   method,
+		url:      url,
+		body:     body,
+		headers:  c.Headers,
+		interval: c.Interval,
+		lastSent: map[string]map[string]time.Time{},
+	}, nil
+}
+
+func (w *webhookPublisher) publish(target string, streams []collector.Stream) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	lastSent := w.lastSent[target]
+	if lastSent == nil {
+		lastSent = map[string]time.Time{}
+		w.lastSent[target] = lastSent
+	}
+	now := time.Now()
+	for _, s := range streams {
+		if now.Sub(lastSent[s.ListenURL]) < w.interval {
+			continue
+		}
+		lastSent[s.ListenURL] = now
+		go func(s collector.Stream) {
+			if err := w.send(s); err != nil {
+				log.Printf("Error publishing %s to webhook: %v", s.Mount, err)
+			}
+		}(s)
+	}
+	// entries past the interval no longer limit anything, e.g. of
+	// disconnected sources
+	for listenURL, sent := range lastSent {
+		if now.Sub(sent) >= w.interval {
+			delete(lastSent, listenURL)
+		}
+	}
+}
+
+func (w *webhookPublisher) forget(target string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.lastSent, target)
+}
+
+func (w *webhookPublisher) send(s collector.Stream) error {
+	url, err := executeTemplate(w.url, s)
+	if err != nil {
+		return err
+	}
+	body, err := executeTemplate(w.body, s)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(w.method, url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP status %s from %s", resp.Status, url)
+	}
+	return nil
+}
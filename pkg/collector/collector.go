@@ -0,0 +1,201 @@
+// Package collector exports the listeners of Icecast servers as Prometheus
+// metrics
+package collector
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+const (
+	listenersHelp = "Gauge representing current Icecast stream listeners"
+	formatHelp    = "Listeners of all mounts of a station by stream format like mp3, aac or ogg"
+)
+
+var upDesc = prometheus.NewDesc("icecast_up", "Whether the last poll of the Icecast target succeeded", []string{"target"}, nil)
+
+type Options struct {
+	// make label values compatible with Prometheus < 3.0
+	LegacyLabels bool
+	// rendering of the stream_url label, the mount if empty
+	StreamURLFormat StreamURLFormat
+	// client used to poll targets, http.DefaultClient if nil
+	Client *icecast.Client
+	// timeout of a single poll, no timeout if 0
+	Timeout time.Duration
+	// export icecast_listeners and icecast_listeners_by_format with the time
+	// of the poll as timestamp, the oldest one of the summed up targets
+	Timestamps bool
+}
+
+// TargetStreams are the streams of a target together with the labels added
+// to its series
+type TargetStreams struct {
+	Labels  map[string]string
+	Streams []Stream
+	// time of the poll, the sample timestamp with Options.Timestamps
+	PolledAt time.Time
+}
+
+// ListenerCollector exports icecast_listeners for streams polled elsewhere,
+// e.g. in the background
+type ListenerCollector struct {
+	streams func() []TargetStreams
+	opts    Options
+}
+
+// NewListenerCollector returns a collector exporting the streams returned by
+// streams on every collect
+func NewListenerCollector(streams func() []TargetStreams, opts Options) *ListenerCollector {
+	return &ListenerCollector{streams: streams, opts: opts}
+}
+
+// Describe sends no descriptors, which makes the collector unchecked since
+// the label names depend on the labels of the targets
+func (c *ListenerCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *ListenerCollector) Collect(ch chan<- prometheus.Metric) {
+	collectListeners(ch, c.streams(), c.opts)
+}
+
+func collectListeners(ch chan<- prometheus.Metric, targets []TargetStreams, opts Options) {
+	// the same stream may be reported by more than one target, the first one wins
+	seen := map[string]bool{}
+	// listeners summed up by station and format, kept in order of appearance
+	type formatListeners struct {
+		desc        *prometheus.Desc
+		labelValues []string
+		listeners   int
+		// oldest poll of the summed up streams
+		polledAt time.Time
+	}
+	var formats []*formatListeners
+	formatIndex := map[string]*formatListeners{}
+
+	for _, t := range targets {
+		names := []string{"server_name", "stream_url"}
+		var labelValues []string
+		for name := range t.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names[2:])
+		for _, name := range names[2:] {
+			labelValues = append(labelValues, t.Labels[name])
+		}
+		desc := prometheus.NewDesc("icecast_listeners", listenersHelp, names, nil)
+		formatNames := append([]string{"server_name", "format"}, names[2:]...)
+		formatDesc := prometheus.NewDesc("icecast_listeners_by_format", formatHelp, formatNames, nil)
+
+		for _, s := range t.Streams {
+			labelServer := s.ServerName
+			labelURL := opts.StreamURLFormat.Label(s)
+			if opts.LegacyLabels {
+				labelServer = LegacyLabel(labelServer)
+				labelURL = LegacyLabel(labelURL)
+			}
+
+			values := append([]string{labelServer, labelURL}, labelValues...)
+			key := strings.Join(names, "\xff") + "\xfe" + strings.Join(values, "\xff")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			m := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(s.Listeners), values...)
+			if opts.Timestamps && !t.PolledAt.IsZero() {
+				m = prometheus.NewMetricWithTimestamp(t.PolledAt, m)
+			}
+			ch <- m
+
+			format := Format(s.ContentType)
+			if format == "" {
+				format = "unknown"
+			}
+			formatValues := append([]string{labelServer, format}, labelValues...)
+			formatKey := strings.Join(formatNames, "\xff") + "\xfe" + strings.Join(formatValues, "\xff")
+			f, ok := formatIndex[formatKey]
+			if !ok {
+				f = &formatListeners{desc: formatDesc, labelValues: formatValues}
+				formatIndex[formatKey] = f
+				formats = append(formats, f)
+			}
+			f.listeners += s.Listeners
+			if f.polledAt.IsZero() || t.PolledAt.Before(f.polledAt) {
+				f.polledAt = t.PolledAt
+			}
+		}
+	}
+	for _, f := range formats {
+		m := prometheus.MustNewConstMetric(f.desc, prometheus.GaugeValue, float64(f.listeners), f.labelValues...)
+		if opts.Timestamps && !f.polledAt.IsZero() {
+			m = prometheus.NewMetricWithTimestamp(f.polledAt, m)
+		}
+		ch <- m
+	}
+}
+
+// Target is an Icecast status endpoint polled by a Collector
+type Target struct {
+	URL string
+	// only export the streams of this server name if not empty
+	ServerName string
+	Labels     map[string]string
+}
+
+// Collector polls its targets on every collect and exports their listeners
+// and icecast_up
+type Collector struct {
+	targets []Target
+	opts    Options
+}
+
+func New(targets []Target, opts Options) *Collector {
+	if opts.Client == nil {
+		opts.Client = new(icecast.Client)
+	}
+	return &Collector{targets: targets, opts: opts}
+}
+
+// Describe sends no descriptors, see ListenerCollector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	results := make([]TargetStreams, len(c.targets))
+	up := make([]bool, len(c.targets))
+
+	var wg sync.WaitGroup
+	for i, t := range c.targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			ctx := context.Background()
+			if c.opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+				defer cancel()
+			}
+			status, err := c.opts.Client.Status(ctx, t.URL)
+			if err != nil {
+				return
+			}
+			up[i] = true
+			results[i] = TargetStreams{Labels: t.Labels, Streams: Streams(t.URL, t.ServerName, status), PolledAt: time.Now()}
+		}(i, t)
+	}
+	wg.Wait()
+
+	for i, t := range c.targets {
+		value := 0.0
+		if up[i] {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, value, t.URL)
+	}
+	collectListeners(ch, results, c.opts)
+}
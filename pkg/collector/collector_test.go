@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func gather(t *testing.T, targets []TargetStreams, opts Options) map[string][]*dto.Metric {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewListenerCollector(func() []TargetStreams { return targets }, opts))
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string][]*dto.Metric{}
+	for _, mf := range families {
+		metrics[mf.GetName()] = mf.GetMetric()
+	}
+	return metrics
+}
+
+func TestListenerCollectorTimestamps(t *testing.T) {
+	polled1 := time.Date(2026, 10, 14, 4, 0, 0, 0, time.UTC)
+	polled2 := polled1.Add(-30 * time.Second)
+	targets := []TargetStreams{
+		{
+			Streams:  []Stream{{ServerName: "Radio", Mount: "live.mp3", ListenURL: "http://a/live.mp3", Listeners: 3, ContentType: "audio/mpeg"}},
+			PolledAt: polled1,
+		},
+		{
+			Streams:  []Stream{{ServerName: "Radio", Mount: "live2.mp3", ListenURL: "http://b/live2.mp3", Listeners: 4, ContentType: "audio/mpeg"}},
+			PolledAt: polled2,
+		},
+		// not polled yet
+		{Streams: []Stream{{ServerName: "Other", Mount: "live.ogg", ListenURL: "http://c/live.ogg", Listeners: 1, ContentType: "application/ogg"}}},
+	}
+
+	tests := []struct {
+		name       string
+		timestamps bool
+		// timestamps in ms of icecast_listeners by stream_url and of
+		// icecast_listeners_by_format by server_name, 0 for none
+		listeners map[string]int64
+		formats   map[string]int64
+	}{
+		{
+			"without timestamps",
+			false,
+			map[string]int64{"live.mp3": 0, "live2.mp3": 0, "live.ogg": 0},
+			map[string]int64{"Radio": 0, "Other": 0},
+		},
+		{
+			"with timestamps",
+			true,
+			map[string]int64{"live.mp3": polled1.UnixMilli(), "live2.mp3": polled2.UnixMilli(), "live.ogg": 0},
+			// the sum gets the oldest poll
+			map[string]int64{"Radio": polled2.UnixMilli(), "Other": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := gather(t, targets, Options{Timestamps: tt.timestamps})
+			check := func(name, label string, want map[string]int64) {
+				if len(metrics[name]) != len(want) {
+					t.Fatalf("%d %s series, want %d", len(metrics[name]), name, len(want))
+				}
+				for _, m := range metrics[name] {
+					var value string
+					for _, l := range m.GetLabel() {
+						if l.GetName() == label {
+							value = l.GetValue()
+						}
+					}
+					if got := m.GetTimestampMs(); got != want[value] {
+						t.Errorf("timestamp of %s{%s=%q} = %d, want %d", name, label, value, got, want[value])
+					}
+				}
+			}
+			check("icecast_listeners", "stream_url", tt.listeners)
+			check("icecast_listeners_by_format", "server_name", tt.formats)
+		})
+	}
+}
+
+func TestListenerCollectorSumsFormats(t *testing.T) {
+	targets := []TargetStreams{{Streams: []Stream{
+		{ServerName: "Radio", Mount: "live.mp3", ListenURL: "http://a/live.mp3", Listeners: 3, ContentType: "audio/mpeg"},
+		{ServerName: "Radio", Mount: "low.mp3", ListenURL: "http://a/low.mp3", Listeners: 2, ContentType: "audio/mpeg"},
+		// the same stream reported twice is only counted once
+		{ServerName: "Radio", Mount: "low.mp3", ListenURL: "http://a/low.mp3", Listeners: 2, ContentType: "audio/mpeg"},
+	}}}
+	metrics := gather(t, targets, Options{})
+	if n := len(metrics["icecast_listeners"]); n != 2 {
+		t.Errorf("%d icecast_listeners series, want 2", n)
+	}
+	formats := metrics["icecast_listeners_by_format"]
+	if len(formats) != 1 || formats[0].GetGauge().GetValue() != 5 {
+		t.Errorf("icecast_listeners_by_format = %v, want a single series of 5", formats)
+	}
+}
@@ -0,0 +1,162 @@
+package collector
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/zecktos/icecast-exporter/pkg/icecast"
+)
+
+// Stream describes a collected stream of a target
+type Stream struct {
+	Target     string
+	ServerName string
+	// mount as used in the stream_url label, e.g. live.mp3
+	Mount     string
+	ListenURL string
+	Listeners int
+	// content type of the stream, e.g. audio/mpeg, and the codec within an
+	// Ogg container
+	ContentType string
+	Subtype     string
+	// nominal bitrate in kbit/s, 0 if unknown
+	Bitrate float64
+	// metadata of the source, empty if not set
+	Description string
+	Genre       string
+	Title       string
+	Artist      string
+}
+
+// MountLabel returns the last path element of a listen URL
+func MountLabel(name string) string {
+	i := strings.LastIndex(name, "/")
+	if i >= 0 {
+		name = name[i:][1:]
+	}
+	return name
+}
+
+// StreamURLFormat selects how the stream_url label of a listen URL is rendered
+type StreamURLFormat string
+
+const (
+	// last path element like live.mp3, the default
+	StreamURLMount StreamURLFormat = "mount"
+	// path like /radio/live.mp3
+	StreamURLPath StreamURLFormat = "path"
+	// host and last path element like icecast1.example.com:8000/live.mp3
+	StreamURLHostAndMount StreamURLFormat = "host-and-mount"
+	// the listen URL as reported by the server
+	StreamURLFull StreamURLFormat = "full-url"
+)
+
+// ParseStreamURLFormat returns the format of its name, the empty name is the
+// default format
+func ParseStreamURLFormat(name string) (StreamURLFormat, error) {
+	switch f := StreamURLFormat(name); f {
+	case "":
+		return StreamURLMount, nil
+	case StreamURLMount, StreamURLPath, StreamURLHostAndMount, StreamURLFull:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q, must be mount, path, host-and-mount or full-url", name)
+}
+
+// Label returns the stream_url label of a stream, its mount if the listen URL
+// cannot be parsed
+func (f StreamURLFormat) Label(s Stream) string {
+	if f == "" || f == StreamURLMount {
+		return s.Mount
+	}
+	if f == StreamURLFull {
+		return s.ListenURL
+	}
+	u, err := url.Parse(s.ListenURL)
+	if err != nil || u.Host == "" || u.Path == "" {
+		return s.Mount
+	}
+	if f == StreamURLPath {
+		return u.Path
+	}
+	return u.Host + "/" + s.Mount
+}
+
+var legacyLabelChars = regexp.MustCompile(`[a-zA-Z_:][a-zA-Z0-9_:]*`)
+
+// LegacyLabel makes a label value compatible with Prometheus < 3.0 by
+// replacing dots and spaces with underscores and dropping other characters
+func LegacyLabel(name string) string {
+	name = strings.ReplaceAll(name, ".", "_")
+	name = strings.ReplaceAll(name, " ", "_")
+
+	matches := legacyLabelChars.FindAllString(name, -1)
+	return strings.Join(matches, "")
+}
+
+// bitrate returns the nominal bitrate of a source in kbit/s, from its audio
+// info if the source client did not send it
+func bitrate(s icecast.Stream) float64 {
+	if s.Bitrate > 0 {
+		return float64(s.Bitrate)
+	}
+	return float64(s.AudioBitrate) / 1000
+}
+
+// Format returns the format of a stream by its content type like mp3, aac or
+// ogg, the subtype of unknown content types and an empty string without one
+func Format(contentType string) string {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+	switch contentType {
+	case "":
+		return ""
+	case "audio/mpeg", "audio/mp3", "audio/mpeg3":
+		return "mp3"
+	case "audio/aac", "audio/aacp", "audio/x-aac", "audio/mp4":
+		return "aac"
+	case "application/ogg", "audio/ogg", "video/ogg":
+		return "ogg"
+	}
+	if i := strings.Index(contentType, "/"); i >= 0 {
+		return strings.TrimPrefix(contentType[i+1:], "x-")
+	}
+	return contentType
+}
+
+// Streams returns the connected streams of a status, only those of serverName
+// unless it is empty
+func Streams(target, serverName string, status *icecast.StatusRoot) []Stream {
+	// icecast omits the source key if no source is connected, which leaves
+	// Source empty
+	var streams []Stream
+	for _, s := range status.Icestats.Source {
+		// inactive mounts are reported as placeholders without listen url
+		if s.ListenURL == "" {
+			continue
+		}
+		if s.ServerName == serverName || serverName == "" {
+			streams = append(streams, Stream{
+				Target:     target,
+				ServerName: s.ServerName,
+				Mount:      MountLabel(s.ListenURL),
+				ListenURL:  s.ListenURL,
+				Listeners:  s.Listeners,
+
+				ContentType: s.ServerType,
+				Subtype:     s.Subtype,
+				Bitrate:     bitrate(s),
+
+				Description: s.ServerDescription,
+				Genre:       s.Genre,
+				Title:       s.Title,
+				Artist:      s.Artist,
+			})
+		}
+	}
+	return streams
+}
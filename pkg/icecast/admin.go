@@ -0,0 +1,147 @@
+package icecast
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Listener is a client connected to a mount as reported by the admin
+// listclients endpoint
+type Listener struct {
+	// Icecast 2.4 reports the id as element, KH and 2.5 as attribute
+	ID        string `xml:"ID"`
+	IDAttr    string `xml:"id,attr"`
+	IP        string `xml:"IP"`
+	UserAgent string `xml:"UserAgent"`
+	// seconds since the listener connected
+	Connected int64 `xml:"Connected"`
+}
+
+// Key returns the id of the listener, unique per server until it restarts
+func (l Listener) Key() string {
+	if l.ID != "" {
+		return l.ID
+	}
+	return l.IDAttr
+}
+
+type listClients struct {
+	Sources []struct {
+		Mount     string     `xml:"mount,attr"`
+		Listeners []Listener `xml:"listener"`
+	} `xml:"source"`
+}
+
+// ServerURL returns the scheme and host of a status URL, the base of the admin
+// endpoints
+func ServerURL(statusURL string) (string, error) {
+	u, err := url.Parse(statusURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid url %q", statusURL)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// AdminStats are the statistics of the admin stats endpoint, only the fields
+// used by the exporter are parsed
+type AdminStats struct {
+	// connections of relays to their masters since the server started
+	SourceRelayConnections int64         `xml:"source_relay_connections"`
+	Sources                []AdminSource `xml:"source"`
+}
+
+// AdminSource are the statistics of a mount in the admin stats
+type AdminSource struct {
+	// mount like /live.mp3
+	Mount string
+	// all statistics of the mount by name, they differ between servers
+	Stats map[string]string
+}
+
+func (s *AdminSource) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "mount" {
+			s.Mount = attr.Value
+		}
+	}
+	s.Stats = map[string]string{}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var value string
+			// nested elements like audio_info only keep their text
+			if err := d.DecodeElement(&value, &t); err != nil {
+				return err
+			}
+			s.Stats[t.Name.Local] = value
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// adminGet loads an admin endpoint like /admin/stats of the server and
+// decodes the XML response into v
+func (c *Client) adminGet(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding icecast admin response: %w", err)
+	}
+	return nil
+}
+
+// Stats loads the admin statistics of the server, it needs admin credentials
+func (c *Client) Stats(ctx context.Context, server string) (*AdminStats, error) {
+	stats := new(AdminStats)
+	if err := c.adminGet(ctx, strings.TrimSuffix(server, "/")+"/admin/stats", stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ListClients loads the listeners of a mount like /live.mp3 from the admin
+// interface of the server, it needs admin credentials
+func (c *Client) ListClients(ctx context.Context, server, mount string) ([]Listener, error) {
+	endpoint := strings.TrimSuffix(server, "/") + "/admin/listclients?mount=" + url.QueryEscape(mount)
+	var clients listClients
+	if err := c.adminGet(ctx, endpoint, &clients); err != nil {
+		return nil, err
+	}
+	var listeners []Listener
+	for _, s := range clients.Sources {
+		for _, l := range s.Listeners {
+			if c.ListenerIP != nil {
+				l.IP = c.ListenerIP(l.IP)
+			}
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners, nil
+}
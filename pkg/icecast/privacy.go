@@ -0,0 +1,34 @@
+package icecast
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+)
+
+// TruncateIP zeroes the host part of an IP address, keeping the /24 of IPv4
+// and the /48 of IPv6 addresses. Invalid addresses are dropped
+func TruncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// HashIP returns a function replacing an IP address by a keyed hash, the
+// same for an address as long as the key is the same
+func HashIP(key []byte) func(ip string) string {
+	return func(ip string) string {
+		if ip == "" {
+			return ""
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+}
@@ -0,0 +1,183 @@
+// Package icecast is a client for the status and admin endpoints of Icecast
+// servers
+package icecast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type StatusRoot struct {
+	Icestats Stats
+}
+
+type Stats struct {
+	Source Source
+}
+
+type Source []Stream
+
+type Stream struct {
+	Listeners         int
+	ServerName        string `json:"server_name"`
+	ServerDescription string `json:"server_description"`
+	ServerType        string `json:"server_type"`
+	// codec within an Ogg container, e.g. Vorbis or Opus
+	Subtype string `json:"subtype"`
+	// nominal bitrate in kbit/s sent by the source client
+	Bitrate Number `json:"bitrate"`
+	// bitrate in bit/s from the audio info of the source
+	AudioBitrate Number `json:"audio_bitrate"`
+	Genre        string `json:"genre"`
+	Title        string `json:"title"`
+	Artist       string `json:"artist"`
+	ListenURL    string `json:"listenurl"`
+}
+
+// Number is a number Icecast reports either as JSON number or as string,
+// depending on the version and the source client. Not a number is 0
+type Number float64
+
+func (n *Number) UnmarshalJSON(data []byte) error {
+	var f float64
+	if err := json.Unmarshal(data, &f); err == nil {
+		*n = Number(f)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		f, _ = strconv.ParseFloat(strings.TrimSpace(s), 64)
+	}
+	*n = Number(f)
+	return nil
+}
+
+func (sourcePtr *Source) UnmarshalJSON(data []byte) error {
+	// decode the entries one by one so a single odd placeholder entry does not
+	// fail the whole status
+	var rawStreams []json.RawMessage
+	if err := json.Unmarshal(data, &rawStreams); err == nil {
+		multiStream := make([]Stream, 0, len(rawStreams))
+		for _, raw := range rawStreams {
+			var stream Stream
+			if err := json.Unmarshal(raw, &stream); err == nil {
+				multiStream = append(multiStream, stream)
+			}
+		}
+		*sourcePtr = multiStream
+		return nil
+	}
+
+	var singleStream Stream
+	if err := json.Unmarshal(data, &singleStream); err == nil {
+		*sourcePtr = []Stream{singleStream}
+		return nil
+	}
+	return fmt.Errorf("error parsing icestats source")
+}
+
+// Client polls Icecast servers, the zero value uses http.DefaultClient
+type Client struct {
+	HTTPClient *http.Client
+	// basic auth sent with every request if not empty
+	Username string
+	Password string
+	// applied to the IP of every listener right after parsing the admin
+	// client list, e.g. TruncateIP, keeps the IP if nil
+	ListenerIP func(ip string) string
+	// called with every response of the status endpoint before it is
+	// parsed, e.g. to keep it for debugging
+	OnStatusResponse func(r Response)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Status loads the status-json.xsl endpoint at url
+func (c *Client) Status(ctx context.Context, url string) (stats *StatusRoot, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if c.OnStatusResponse != nil {
+			// error pages are only kept for debugging, a truncated one is fine
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+			c.OnStatusResponse(newResponse(url, resp, body))
+		}
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	respIO, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if c.OnStatusResponse != nil {
+		c.OnStatusResponse(newResponse(url, resp, respIO))
+	}
+	return ParseStatus(respIO)
+}
+
+// ParseStatus parses a response of the status-json.xsl endpoint
+func ParseStatus(body []byte) (*StatusRoot, error) {
+	stats := new(StatusRoot)
+
+	if err := json.NewDecoder(strings.NewReader(FixBlankTitle(body))).Decode(stats); err != nil {
+		return nil, fmt.Errorf("error decoding icecast status: %w", err)
+	}
+
+	return stats, nil
+}
+
+// FixBlankTitle replaces the invalid JSON Icecast writes for a blank title
+// https://stackoverflow.com/questions/30269678/icecast-json-status-xls-not-valid-json-answer-with-blank-song-title
+func FixBlankTitle(body []byte) string {
+	return strings.ReplaceAll(string(body), "\"title\": -", "\"title\": null")
+}
+
+// Response is an unparsed response of the status endpoint
+type Response struct {
+	URL         string
+	Status      string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ReceivedAt  time.Time
+}
+
+func newResponse(url string, resp *http.Response, body []byte) Response {
+	return Response{
+		URL:         url,
+		Status:      resp.Status,
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        body,
+		ReceivedAt:  time.Now(),
+	}
+}
+
+// LoadStatus loads the status endpoint at url with http.DefaultClient
+func LoadStatus(ctx context.Context, url string) (*StatusRoot, error) {
+	return new(Client).Status(ctx, url)
+}